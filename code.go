@@ -0,0 +1,198 @@
+package watersort
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+)
+
+// codeVersion is the version of the binary level code format.
+const codeVersion = 1
+
+// ErrInvalidCode is returned by DecodeCode for malformed or corrupted codes.
+var ErrInvalidCode = errors.New("invalid level code")
+
+// EncodeCode returns a short, URL-safe code for s.
+//
+// The code is the base64url encoding of:
+//
+//	version, bottle size, number of bottles, bits per color   1 byte each
+//	number of bottles with constraints                         1 byte
+//	per constrained bottle: index, AcceptOnly, LockedUntil,    1 byte each
+//	  flags (bit 0: NoPourOut)
+//	colors, bottom to top, bit-packed                          ⌈bottles × size × bits / 8⌉ bytes
+//	CRC-32 (IEEE) of all preceding bytes                       4 bytes
+//
+// The palette is not part of the code.
+func EncodeCode(s State) (string, error) {
+	if len(s.Bottles) == 0 {
+		return "", fmt.Errorf("cannot encode a state without bottles")
+	}
+	if len(s.Bottles) > 255 {
+		return "", fmt.Errorf("cannot encode %d bottles, the maximum is 255", len(s.Bottles))
+	}
+
+	size := s.BottleSize()
+	if size == 0 || size > 255 {
+		return "", fmt.Errorf("cannot encode bottle size %d", size)
+	}
+
+	var (
+		maxColor    Color
+		constrained []int
+	)
+	for i, b := range s.Bottles {
+		if len(b.Colors) != size {
+			return "", fmt.Errorf("bottle %d has %d colors, want %d", i+1, len(b.Colors), size)
+		}
+		for _, c := range b.Colors {
+			if c < 0 || c > 255 {
+				return "", fmt.Errorf("cannot encode color %d", c)
+			}
+			if c > maxColor {
+				maxColor = c
+			}
+		}
+		if b.AcceptOnly < 0 || b.AcceptOnly > 255 {
+			return "", fmt.Errorf("bottle %d: cannot encode color %d", i+1, b.AcceptOnly)
+		}
+		if b.LockedUntil < 0 || b.LockedUntil > 255 {
+			return "", fmt.Errorf("bottle %d: cannot encode lock %d", i+1, b.LockedUntil)
+		}
+		if b.hasConstraints() {
+			constrained = append(constrained, i)
+		}
+	}
+
+	width := bits.Len(uint(maxColor))
+	if width == 0 {
+		width = 1
+	}
+
+	data := []byte{codeVersion, byte(size), byte(len(s.Bottles)), byte(width), byte(len(constrained))}
+	for _, i := range constrained {
+		b := s.Bottles[i]
+		var flags byte
+		if b.NoPourOut {
+			flags |= 1
+		}
+		data = append(data, byte(i), byte(b.AcceptOnly), byte(b.LockedUntil), flags)
+	}
+
+	var w bitWriter
+	for _, b := range s.Bottles {
+		for _, c := range b.Colors {
+			w.write(uint(c), width)
+		}
+	}
+	data = append(data, w.bytes()...)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	data = append(data, sum[:]...)
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCode returns the state encoded by code, see EncodeCode.
+// Errors wrap ErrInvalidCode. The state is not validated, see State.Validate.
+func DecodeCode(code string) (State, error) {
+	data, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil {
+		return State{}, fmt.Errorf("%w: %v", ErrInvalidCode, err)
+	}
+
+	if len(data) < 9 {
+		return State{}, fmt.Errorf("%w: code is too short", ErrInvalidCode)
+	}
+
+	payload, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != sum {
+		return State{}, fmt.Errorf("%w: checksum mismatch, the code is corrupted", ErrInvalidCode)
+	}
+
+	if v := payload[0]; v != codeVersion {
+		return State{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidCode, v)
+	}
+
+	size, bottles, width, numConstrained := int(payload[1]), int(payload[2]), int(payload[3]), int(payload[4])
+	if size == 0 || bottles == 0 || width == 0 || width > 8 {
+		return State{}, fmt.Errorf("%w: invalid header", ErrInvalidCode)
+	}
+
+	payload = payload[5:]
+	if len(payload) < 4*numConstrained {
+		return State{}, fmt.Errorf("%w: code is truncated", ErrInvalidCode)
+	}
+	constraints, payload := payload[:4*numConstrained], payload[4*numConstrained:]
+
+	if want := (bottles*size*width + 7) / 8; len(payload) != want {
+		return State{}, fmt.Errorf("%w: got %d bytes of colors, want %d", ErrInvalidCode, len(payload), want)
+	}
+
+	r := bitReader{data: payload}
+	s := State{
+		Bottles: make([]Bottle, bottles),
+	}
+	for i := range s.Bottles {
+		s.Bottles[i].Colors = make([]Color, size)
+		for j := range s.Bottles[i].Colors {
+			s.Bottles[i].Colors[j] = Color(r.read(width))
+		}
+	}
+
+	for i := 0; i < len(constraints); i += 4 {
+		idx := int(constraints[i])
+		if idx >= bottles {
+			return State{}, fmt.Errorf("%w: constraint for bottle %d, but there are %d bottles", ErrInvalidCode, idx+1, bottles)
+		}
+		b := &s.Bottles[idx]
+		b.AcceptOnly = Color(constraints[i+1])
+		b.LockedUntil = int(constraints[i+2])
+		b.NoPourOut = constraints[i+3]&1 != 0
+	}
+
+	return s, nil
+}
+
+// bitWriter packs values into bytes, most significant bit first.
+type bitWriter struct {
+	data  []byte
+	nbits int
+}
+
+func (w *bitWriter) write(v uint, width int) {
+	for i := width - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v&(1<<i) != 0 {
+			w.data[len(w.data)-1] |= 1 << (7 - w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+// bitReader reads values written by bitWriter.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(width int) uint {
+	var v uint
+	for i := 0; i < width; i++ {
+		v <<= 1
+		if r.data[r.pos/8]&(1<<(7-r.pos%8)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package watersort
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		name string
+		in   State
+	}{
+		{
+			name: "level 105",
+			in:   level105,
+		},
+		{
+			name: "constraints",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}, NoPourOut: true},
+					{Colors: []Color{Green, Red}},
+					{Colors: []Color{Empty, Empty}, AcceptOnly: Red},
+					{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+				},
+			},
+		},
+		{
+			name: "many colors",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{1, 200}},
+					{Colors: []Color{200, 1}},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := EncodeCode(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := DecodeCode(code)
+			if err != nil {
+				t.Fatalf("DecodeCode(%q): %v", code, err)
+			}
+
+			if diff := cmp.Diff(tc.in, got); diff != "" {
+				t.Errorf("state differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCode_Short(t *testing.T) {
+	code, err := EncodeCode(level105)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := level105.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(code) >= len(text)/2 {
+		t.Errorf("EncodeCode() = %q (%d bytes), want less than half the size of %q", code, len(code), text)
+	}
+}
+
+func TestDecodeCode_Corrupted(t *testing.T) {
+	code, err := EncodeCode(level105)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := []byte(code)
+	if corrupted[10] == 'A' {
+		corrupted[10] = 'B'
+	} else {
+		corrupted[10] = 'A'
+	}
+
+	for _, in := range []string{string(corrupted), code[:len(code)-3], "not*base64", ""} {
+		if _, err := DecodeCode(in); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("DecodeCode(%q) = %v, want %v", in, err, ErrInvalidCode)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package watersort
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNothingToUndo = errors.New("there is no move to undo")
+	ErrNothingToRedo = errors.New("there is no move to redo")
+	ErrUndoLimit     = errors.New("undo limit reached")
+	ErrNoExtraBottle = errors.New("no extra bottle left")
+)
+
+// Game is an interactive play session of a level.
+// It keeps track of the moves played and supports undo, redo and restart.
+type Game struct {
+	// states holds the state before each move in steps, plus the current state.
+	states []State
+	steps  []Step
+	// redo holds undone moves, the most recently undone move last.
+	redo []Step
+
+	undoLimit int
+	undoCount int
+
+	extraBottles int
+	winCondition WinCondition
+}
+
+type GameOption func(*Game)
+
+// UndoLimit limits the number of moves that can be undone.
+// By default, the number of undos is unlimited.
+func UndoLimit(n int) GameOption {
+	return func(g *Game) {
+		g.undoLimit = n
+	}
+}
+
+// defaultExtraBottles is the number of extra bottles that may be added per
+// game. State.Replay and SolutionFile.Verify enforce the same limit.
+const defaultExtraBottles = 1
+
+// ExtraBottleLimit sets the number of extra empty bottles the player may add.
+// By default, one extra bottle may be added per game.
+func ExtraBottleLimit(n int) GameOption {
+	return func(g *Game) {
+		g.extraBottles = n
+	}
+}
+
+// GameWinCondition sets the condition under which the game is won.
+// By default, DefaultWinCondition is used.
+func GameWinCondition(wc WinCondition) GameOption {
+	return func(g *Game) {
+		g.winCondition = wc
+	}
+}
+
+// NewGame starts a new game with s as the initial state.
+func NewGame(s State, opts ...GameOption) *Game {
+	g := &Game{
+		states:       []State{s.Clone()},
+		undoLimit:    -1,
+		extraBottles: defaultExtraBottles,
+		winCondition: DefaultWinCondition,
+	}
+
+	for _, f := range opts {
+		f(g)
+	}
+
+	return g
+}
+
+// State returns a copy of the current state.
+func (g *Game) State() State {
+	return g.current().Clone()
+}
+
+func (g *Game) current() State {
+	return g.states[len(g.states)-1]
+}
+
+// InitialState returns a copy of the state the game started with.
+func (g *Game) InitialState() State {
+	return g.states[0].Clone()
+}
+
+// Steps returns the moves played so far.
+func (g *Game) Steps() []Step {
+	ret := make([]Step, len(g.steps))
+	copy(ret, g.steps)
+	return ret
+}
+
+// Moves returns the number of moves played so far.
+func (g *Game) Moves() int {
+	return len(g.steps)
+}
+
+// Move plays step. The step's Color is filled in from the source bottle.
+// Steps of type AddBottle use the "extra bottle" power-up.
+// Playing a move discards all moves that could be redone.
+func (g *Game) Move(step Step) error {
+	if err := g.move(step); err != nil {
+		return err
+	}
+
+	g.redo = nil
+	return nil
+}
+
+func (g *Game) move(step Step) error {
+	s := g.current()
+
+	if step.Type == AddBottle {
+		if g.ExtraBottlesLeft() <= 0 {
+			return ErrNoExtraBottle
+		}
+
+		next := s.Clone()
+		if err := next.Apply(step); err != nil {
+			return err
+		}
+
+		g.states = append(g.states, next)
+		g.steps = append(g.steps, Step{Type: AddBottle})
+		return nil
+	}
+
+	if step.From < 0 || step.From >= len(s.Bottles) {
+		return fmt.Errorf("invalid move: there is no bottle %d", step.From+1)
+	}
+	if step.From == step.To {
+		return fmt.Errorf("invalid move: cannot pour bottle %d onto itself", step.From+1)
+	}
+
+	step.Color = s.Bottles[step.From].TopColor()
+	if step.Color == Empty {
+		return fmt.Errorf("invalid move: bottle %d is empty", step.From+1)
+	}
+
+	next := s.Clone()
+	if err := next.Apply(step); err != nil {
+		return fmt.Errorf("invalid move %d → %d: %w", step.From+1, step.To+1, err)
+	}
+
+	g.states = append(g.states, next)
+	g.steps = append(g.steps, step)
+	return nil
+}
+
+// Undo reverts the last move.
+func (g *Game) Undo() error {
+	if len(g.steps) == 0 {
+		return ErrNothingToUndo
+	}
+	if g.undoLimit >= 0 && g.undoCount >= g.undoLimit {
+		return ErrUndoLimit
+	}
+
+	last := len(g.steps) - 1
+	g.redo = append(g.redo, g.steps[last])
+	g.steps = g.steps[:last]
+	g.states = g.states[:len(g.states)-1]
+	g.undoCount++
+
+	return nil
+}
+
+// Redo plays the most recently undone move again.
+func (g *Game) Redo() error {
+	if len(g.redo) == 0 {
+		return ErrNothingToRedo
+	}
+
+	last := len(g.redo) - 1
+	if err := g.move(g.redo[last]); err != nil {
+		return err
+	}
+	g.redo = g.redo[:last]
+
+	return nil
+}
+
+// UndosLeft returns the number of remaining undos, or -1 if unlimited.
+func (g *Game) UndosLeft() int {
+	if g.undoLimit < 0 {
+		return -1
+	}
+	return g.undoLimit - g.undoCount
+}
+
+// ExtraBottlesLeft returns the number of extra bottles that may still be added.
+func (g *Game) ExtraBottlesLeft() int {
+	ret := g.extraBottles
+	for _, step := range g.steps {
+		if step.Type == AddBottle {
+			ret--
+		}
+	}
+	return ret
+}
+
+// Restart resets the game to its initial state.
+// This does not refund undos that have already been used.
+func (g *Game) Restart() {
+	g.states = g.states[:1]
+	g.steps = nil
+	g.redo = nil
+}
+
+// Won returns true if the current state satisfies the game's win condition.
+func (g *Game) Won() bool {
+	return g.winCondition.Won(g.current())
+}
+
+// Stuck returns true if the game is not won and there are no moves left.
+// Adding an extra bottle counts as a move as long as the power-up is available.
+func (g *Game) Stuck() bool {
+	if g.Won() {
+		return false
+	}
+
+	sol := solution{
+		State:        g.current(),
+		ExtraBottles: g.ExtraBottlesLeft(),
+	}
+	return len(sol.PossibleSteps()) == 0
+}
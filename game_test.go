@@ -0,0 +1,127 @@
+package watersort
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGame(t *testing.T) {
+	start := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Empty, Empty}},
+			{Colors: []Color{Empty, Empty}},
+		},
+	}
+
+	g := NewGame(start, UndoLimit(1))
+
+	if err := g.Move(Step{From: 0, To: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Move(Step{From: 0, To: 0}); err == nil {
+		t.Error("Move(0 → 0) succeeded, want error")
+	}
+	if err := g.Move(Step{From: 3, To: 0}); err == nil {
+		t.Error("Move() from an empty bottle succeeded, want error")
+	}
+
+	afterFirst := g.State()
+	if err := g.Move(Step{From: 1, To: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(afterFirst, g.State()); diff != "" {
+		t.Errorf("Undo() state differs (-want/+got):\n%s", diff)
+	}
+	if err := g.Undo(); !errors.Is(err, ErrUndoLimit) {
+		t.Errorf("Undo() = %v, want %v", err, ErrUndoLimit)
+	}
+
+	if err := g.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() = %v, want %v", err, ErrNothingToRedo)
+	}
+
+	if err := g.Move(Step{From: 1, To: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Won() {
+		t.Errorf("Won() = false, want true\nstate: %v", g.State())
+	}
+	if g.Stuck() {
+		t.Error("Stuck() = true, want false")
+	}
+	if got, want := g.Moves(), 3; got != want {
+		t.Errorf("Moves() = %d, want %d", got, want)
+	}
+
+	g.Restart()
+	if diff := cmp.Diff(start, g.State()); diff != "" {
+		t.Errorf("Restart() state differs (-want/+got):\n%s", diff)
+	}
+	if got := g.Moves(); got != 0 {
+		t.Errorf("Moves() = %d after Restart(), want 0", got)
+	}
+}
+
+func TestGame_Stuck(t *testing.T) {
+	g := NewGame(State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Blue, Yellow}},
+			{Colors: []Color{Yellow, Blue}},
+		},
+	}, ExtraBottleLimit(0))
+
+	if !g.Stuck() {
+		t.Error("Stuck() = false, want true")
+	}
+}
+
+func TestGame_ExtraBottle(t *testing.T) {
+	g := NewGame(State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+		},
+	})
+
+	if g.Stuck() {
+		t.Error("Stuck() = true, want false")
+	}
+
+	for _, step := range []Step{
+		{Type: AddBottle},
+		{From: 0, To: 2},
+		{From: 1, To: 0},
+		{From: 1, To: 2},
+	} {
+		if err := g.Move(step); err != nil {
+			t.Fatalf("Move(%v): %v", step, err)
+		}
+	}
+
+	if !g.Won() {
+		t.Errorf("Won() = false, want true\nstate: %v", g.State())
+	}
+	if err := g.Move(Step{Type: AddBottle}); !errors.Is(err, ErrNoExtraBottle) {
+		t.Errorf("Move(AddBottle) = %v, want %v", err, ErrNoExtraBottle)
+	}
+
+	if err := g.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.ExtraBottlesLeft(), 0; got != want {
+		t.Errorf("ExtraBottlesLeft() = %d, want %d", got, want)
+	}
+}
@@ -14,17 +14,21 @@ import (
 var (
 	num  = flag.Int("num", 10, "number of colors/bottles; does not include empty bottles")
 	size = flag.Int("size", 4, "number of slots in each bottle")
+	pack = flag.String("pack", "", "if set, write the generated levels to this level pack file")
 )
 
 func main() {
 	flag.Parse()
 
+	var levels watersort.LevelPack
+	levels.Name = fmt.Sprintf("Generated levels (%d colors, bottle size %d)", *num, *size)
+
 	maxComplexity := 0
 	for {
 		s := watersort.RandomState(*num, *size)
 
 		var complexity int
-		_, err := s.Solve(watersort.ReportComplexity(&complexity))
+		steps, err := s.Solve(watersort.ReportComplexity(&complexity))
 		if errors.Is(err, watersort.ErrNoSolution) {
 			fmt.Println("=== Unsolvable ===")
 			json.NewEncoder(os.Stdout).Encode(s)
@@ -38,6 +42,33 @@ func main() {
 			fmt.Printf("=== Complexity %d ===\n", complexity)
 			json.NewEncoder(os.Stdout).Encode(s)
 			maxComplexity = complexity
+
+			if *pack != "" {
+				levels.Levels = append(levels.Levels, watersort.Level{
+					ID:            fmt.Sprintf("gen-%d", len(levels.Levels)+1),
+					Difficulty:    complexity,
+					OptimalLength: len(steps),
+					Solution:      steps,
+					State:         s,
+				})
+				if err := writePack(*pack, levels); err != nil {
+					log.Fatal(err)
+				}
+			}
 		}
 	}
 }
+
+func writePack(path string, p watersort.LevelPack) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := watersort.WriteLevelPack(f, p); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+
+	"github.com/octo/watersort"
+	"github.com/octo/watersort/screenshot"
+)
+
+var (
+	input         = flag.String("input", "", "PNG or JPEG screenshot to read")
+	size          = flag.Int("size", 4, "number of slots in each bottle")
+	headSpace     = flag.Float64("head_space", 0.1, "fraction of the bottle's inner height above the highest slot")
+	minConfidence = flag.Float64("min_confidence", 0.6, "warn about slots detected with less confidence")
+	paletteFile   = flag.String("palette", "", "JSON file with the palette to use instead of the default one")
+	format        = flag.String("format", "text", "output format; \"text\" or \"json\"")
+)
+
+func main() {
+	flag.Parse()
+
+	if *input == "" {
+		log.Fatal("the -input flag is required")
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatalf("%s: %v", *input, err)
+	}
+
+	opts := screenshot.Options{
+		BottleSize:    *size,
+		HeadSpace:     *headSpace,
+		MinConfidence: *minConfidence,
+	}
+	if *paletteFile != "" {
+		data, err := os.ReadFile(*paletteFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &opts.Palette); err != nil {
+			log.Fatalf("%s: %v", *paletteFile, err)
+		}
+	}
+
+	res, err := screenshot.Import(img, opts)
+	var verr *watersort.ValidationError
+	if err != nil && !errors.As(err, &verr) {
+		log.Fatalln("screenshot.Import():", err)
+	}
+
+	for _, w := range res.Warnings {
+		log.Println("Warning:", w)
+	}
+	if verr != nil {
+		log.Println("The detected level is not valid:", verr)
+	}
+
+	switch *format {
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(res.State)
+	default:
+		err = watersort.WriteText(os.Stdout, watersort.TextLevel{State: res.State})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if verr != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,210 @@
+package watersort
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// LevelPackVersion is the version of the level pack format written by WriteLevelPack.
+const LevelPackVersion = 1
+
+// LevelPack is a collection of levels with metadata, stored as a single JSON file:
+//
+//	{
+//	  "version": 1,
+//	  "name": "Regression levels",
+//	  "levels": [
+//	    {
+//	      "id": "wsp-105",
+//	      "source": "Water Sort Puzzle",
+//	      "number": 105,
+//	      "optimal_length": 41,
+//	      "state": [["Blue", "Blue", "DarkGreen", "DarkBlue"], …]
+//	    }
+//	  ]
+//	}
+type LevelPack struct {
+	Version int     `json:"version"`
+	Name    string  `json:"name,omitempty"`
+	Levels  []Level `json:"levels"`
+}
+
+// Level is a level together with its metadata.
+type Level struct {
+	// ID uniquely identifies the level within its pack.
+	ID   string
+	Name string
+	// Source is the game the level is taken from, and Number the level's
+	// number in that game.
+	Source string
+	Number int
+	Author string
+	// Difficulty rates the level. Higher values are harder; the scale is up to the pack.
+	Difficulty int
+	// OptimalLength is the number of steps of an optimal solution, or zero if unknown.
+	OptimalLength int
+	// Solution is an optional reference solution.
+	Solution []Step
+
+	State State
+}
+
+type levelJSON struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name,omitempty"`
+	Source        string     `json:"source,omitempty"`
+	Number        int        `json:"number,omitempty"`
+	Author        string     `json:"author,omitempty"`
+	Difficulty    int        `json:"difficulty,omitempty"`
+	OptimalLength int        `json:"optimal_length,omitempty"`
+	Solution      []stepJSON `json:"solution,omitempty"`
+	State         State      `json:"state"`
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	lj := levelJSON{
+		ID:            l.ID,
+		Name:          l.Name,
+		Source:        l.Source,
+		Number:        l.Number,
+		Author:        l.Author,
+		Difficulty:    l.Difficulty,
+		OptimalLength: l.OptimalLength,
+		State:         l.State,
+	}
+	for _, step := range l.Solution {
+		lj.Solution = append(lj.Solution, step.toJSON(l.State.Palette))
+	}
+
+	return json.Marshal(lj)
+}
+
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var lj levelJSON
+	if err := json.Unmarshal(data, &lj); err != nil {
+		return err
+	}
+
+	*l = Level{
+		ID:            lj.ID,
+		Name:          lj.Name,
+		Source:        lj.Source,
+		Number:        lj.Number,
+		Author:        lj.Author,
+		Difficulty:    lj.Difficulty,
+		OptimalLength: lj.OptimalLength,
+		State:         lj.State,
+	}
+	for _, sj := range lj.Solution {
+		var step Step
+		if err := step.fromJSON(sj, lj.State.Palette); err != nil {
+			return err
+		}
+		l.Solution = append(l.Solution, step)
+	}
+
+	return nil
+}
+
+// Check validates the level's state and, if present, replays the reference
+// solution to make sure it solves the level.
+func (l Level) Check() error {
+	if err := l.State.Validate(); err != nil {
+		return err
+	}
+
+	if l.Solution == nil {
+		return nil
+	}
+
+	if l.OptimalLength != 0 && len(l.Solution) < l.OptimalLength {
+		return fmt.Errorf("reference solution has %d steps, but the optimal solution has %d",
+			len(l.Solution), l.OptimalLength)
+	}
+
+	return l.State.Replay(l.Solution)
+}
+
+// Replay applies steps to a copy of s and returns an error if s is not valid,
+// if a step cannot be applied or if the resulting state is not solved. Like in
+// a Game, at most one extra bottle may be added.
+func (s State) Replay(steps []Step) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	s = s.Clone()
+	extraBottles := defaultExtraBottles
+	for i, step := range steps {
+		if step.Type == AddBottle {
+			if extraBottles <= 0 {
+				return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(step), ErrNoExtraBottle)
+			}
+			extraBottles--
+		}
+		if err := s.Apply(step); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(step), err)
+		}
+	}
+
+	if !s.Solved() {
+		return fmt.Errorf("state is not solved after %d steps", len(steps))
+	}
+	return nil
+}
+
+// LoadLevelPack reads a level pack from r and checks all of its levels.
+func LoadLevelPack(r io.Reader) (LevelPack, error) {
+	var p LevelPack
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return LevelPack{}, err
+	}
+
+	if p.Version < 1 || p.Version > LevelPackVersion {
+		return LevelPack{}, fmt.Errorf("unsupported level pack version %d", p.Version)
+	}
+
+	ids := make(map[string]bool)
+	for i, l := range p.Levels {
+		if l.ID == "" {
+			return LevelPack{}, fmt.Errorf("level #%d: missing ID", i+1)
+		}
+		if ids[l.ID] {
+			return LevelPack{}, fmt.Errorf("level #%d: duplicate ID %q", i+1, l.ID)
+		}
+		ids[l.ID] = true
+
+		if err := l.Check(); err != nil {
+			return LevelPack{}, fmt.Errorf("level %q: %w", l.ID, err)
+		}
+	}
+
+	return p, nil
+}
+
+// WriteLevelPack writes p to w as indented JSON.
+// If p.Version is zero, LevelPackVersion is used.
+func WriteLevelPack(w io.Writer, p LevelPack) error {
+	if p.Version == 0 {
+		p.Version = LevelPackVersion
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Level returns the level with the given ID.
+func (p LevelPack) Level(id string) (Level, bool) {
+	for _, l := range p.Levels {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return Level{}, false
+}
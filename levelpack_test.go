@@ -0,0 +1,167 @@
+package watersort
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLevelPack_Regression(t *testing.T) {
+	f, err := os.Open(filepath.Join("solver", "testdata", "packs", "regression.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pack, err := LoadLevelPack(f)
+	if err != nil {
+		t.Fatalf("LoadLevelPack(): %v", err)
+	}
+
+	for _, l := range pack.Levels {
+		l := l
+		t.Run(l.ID, func(t *testing.T) {
+			if l.OptimalLength == 0 {
+				t.Skip("optimal length unknown")
+			}
+
+			steps, err := l.State.Solve()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(steps); got != l.OptimalLength {
+				t.Errorf("solution has %d steps, want %d", got, l.OptimalLength)
+			}
+		})
+	}
+}
+
+func TestLevelPack_RoundTrip(t *testing.T) {
+	want := LevelPack{
+		Version: LevelPackVersion,
+		Name:    "Custom",
+		Levels: []Level{
+			{
+				ID:            "tiny",
+				Author:        "octo",
+				Difficulty:    1,
+				OptimalLength: 4,
+				Solution: []Step{
+					{Type: AddBottle},
+					{From: 0, To: 2, Color: 2},
+					{From: 1, To: 0, Color: 1},
+					{From: 1, To: 2, Color: 2},
+				},
+				State: State{
+					Bottles: []Bottle{
+						{Colors: []Color{1, 2}},
+						{Colors: []Color{2, 1}},
+					},
+					Palette: Palette{
+						{Name: "Teal", Symbol: "T"},
+						{Name: "Rose", Symbol: "S"},
+					},
+				},
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteLevelPack(&b, want); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"color": "Rose"`) {
+		t.Errorf("WriteLevelPack() = %s, want step colors named by the palette", b.String())
+	}
+
+	// The level has no empty bottles and is therefore rejected by Validate.
+	if _, err := LoadLevelPack(strings.NewReader(b.String())); err == nil {
+		t.Error("LoadLevelPack() succeeded, want a validation error")
+	}
+
+	var got LevelPack
+	if err := json.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("level pack differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestReplay_ExtraBottles(t *testing.T) {
+	s := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Empty, Empty}},
+		},
+	}
+	solution := []Step{{From: 0, To: 2}, {From: 1, To: 0}, {From: 1, To: 2}}
+	add := Step{Type: AddBottle}
+
+	if err := s.Replay(append([]Step{add}, solution...)); err != nil {
+		t.Errorf("Replay() with one extra bottle = %v, want nil", err)
+	}
+	if err := s.Replay(append([]Step{add, add}, solution...)); !errors.Is(err, ErrNoExtraBottle) {
+		t.Errorf("Replay() with two extra bottles = %v, want %v", err, ErrNoExtraBottle)
+	}
+}
+
+func TestReplay_InvalidState(t *testing.T) {
+	for _, s := range []State{{}, {Bottles: []Bottle{{}}}} {
+		var verr *ValidationError
+		if err := s.Replay([]Step{{Type: AddBottle}}); !errors.As(err, &verr) {
+			t.Errorf("Replay() of %v = %v, want a *ValidationError", s, err)
+		}
+
+		if err := s.Apply(Step{Type: AddBottle}); err == nil && len(s.Bottles) == 0 {
+			t.Errorf("Apply(AddBottle) without bottles succeeded, want error")
+		}
+	}
+}
+
+func TestLevelPack_Errors(t *testing.T) {
+	level := `{"id": "a", "state": [["Red", "Green"], ["Green", "Red"], ["Empty", "Empty"], ["Empty", "Empty"]]%s}`
+
+	cases := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "unsupported version",
+			in:   `{"version": 2, "levels": []}`,
+		},
+		{
+			name: "duplicate ID",
+			in:   `{"version": 1, "levels": [` + strings.Replace(level, "%s", "", 1) + `,` + strings.Replace(level, "%s", "", 1) + `]}`,
+		},
+		{
+			name: "wrong solution",
+			in:   `{"version": 1, "levels": [` + strings.Replace(level, "%s", `, "solution": [{"from": 1, "to": 3}]`, 1) + `]}`,
+		},
+		{
+			name: "solution shorter than optimal",
+			in: `{"version": 1, "levels": [` + strings.Replace(level, "%s",
+				`, "optimal_length": 4, "solution": [{"from": 1, "to": 3}, {"from": 2, "to": 1}, {"from": 2, "to": 3}]`, 1) + `]}`,
+		},
+		{
+			name: "two extra bottles",
+			in: `{"version": 1, "levels": [` + strings.Replace(level, "%s",
+				`, "solution": [{"type": "add_bottle"}, {"type": "add_bottle"}, {"from": 1, "to": 3}, {"from": 2, "to": 1}, {"from": 2, "to": 3}]`, 1) + `]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := LoadLevelPack(strings.NewReader(tc.in)); err == nil {
+				t.Error("LoadLevelPack() succeeded, want error")
+			}
+		})
+	}
+}
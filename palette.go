@@ -0,0 +1,233 @@
+package watersort
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PaletteEntry describes how a color is named and displayed.
+type PaletteEntry struct {
+	// Name is used in level files and in messages, e.g. "Red".
+	Name string `json:"name"`
+	// RGB is the CSS hex notation of the color, e.g. "#d8322c". If empty, a
+	// color is generated.
+	RGB string `json:"rgb"`
+	// Symbol is a single character used in text representations, e.g. "R".
+	Symbol string `json:"symbol"`
+}
+
+func (e *PaletteEntry) UnmarshalJSON(data []byte) error {
+	type plain PaletteEntry
+	var pe plain
+	if err := json.Unmarshal(data, &pe); err != nil {
+		return err
+	}
+	if pe.RGB != "" {
+		if _, err := parseRGB(pe.RGB); err != nil {
+			return fmt.Errorf("color %q: %w", pe.Name, err)
+		}
+	}
+
+	*e = PaletteEntry(pe)
+	return nil
+}
+
+// parseRGB parses the "#rrggbb" notation.
+func parseRGB(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid RGB value %q, want \"#rrggbb\"", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid RGB value %q, want \"#rrggbb\"", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Palette maps colors to names, RGB values and symbols.
+// Palette[i] describes Color(i+1); Empty is implicit and not part of the palette.
+//
+// A nil Palette behaves like DefaultPalette.
+type Palette []PaletteEntry
+
+// DefaultPalette holds the colors used by the "Water Sort Puzzle" game.
+var DefaultPalette = Palette{
+	Blue - 1:       {Name: "Blue", RGB: "#3c6be0", Symbol: "B"},
+	Brown - 1:      {Name: "Brown", RGB: "#7e4a1e", Symbol: "N"},
+	DarkBlue - 1:   {Name: "DarkBlue", RGB: "#1b2a8c", Symbol: "D"},
+	DarkGreen - 1:  {Name: "DarkGreen", RGB: "#1f6b32", Symbol: "E"},
+	Gray - 1:       {Name: "Gray", RGB: "#8a8a8a", Symbol: "A"},
+	Green - 1:      {Name: "Green", RGB: "#5fd35a", Symbol: "G"},
+	LightBlue - 1:  {Name: "LightBlue", RGB: "#6fd0f0", Symbol: "C"},
+	LightGreen - 1: {Name: "LightGreen", RGB: "#b5e86b", Symbol: "L"},
+	Orange - 1:     {Name: "Orange", RGB: "#f08c2a", Symbol: "O"},
+	Pink - 1:       {Name: "Pink", RGB: "#f06fae", Symbol: "P"},
+	Purple - 1:     {Name: "Purple", RGB: "#8a3cc8", Symbol: "U"},
+	Red - 1:        {Name: "Red", RGB: "#d8322c", Symbol: "R"},
+	Yellow - 1:     {Name: "Yellow", RGB: "#f2d43a", Symbol: "Y"},
+}
+
+const (
+	emptyName   = "Empty"
+	emptySymbol = "."
+)
+
+func (p Palette) entry(c Color) (PaletteEntry, bool) {
+	if p == nil {
+		p = DefaultPalette
+	}
+	if c <= Empty || int(c) > len(p) {
+		return PaletteEntry{}, false
+	}
+	return p[c-1], true
+}
+
+// Name returns the name of c, or "color#<n>" if c is not part of the palette.
+func (p Palette) Name(c Color) string {
+	if c == Empty {
+		return emptyName
+	}
+	if e, ok := p.entry(c); ok && e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("color#%d", c)
+}
+
+// RGB returns the CSS hex notation of c. Colors that are not part of the
+// palette get a generated color, Empty is "transparent".
+func (p Palette) RGB(c Color) string {
+	if c == Empty {
+		return "transparent"
+	}
+	if e, ok := p.entry(c); ok && e.RGB != "" {
+		return e.RGB
+	}
+
+	// Spread generated colors around the color wheel using the golden angle.
+	r, g, b := hsvToRGB(float64(c)*137.508, 0.65, 0.85)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// RGBA returns c as a color.RGBA. Empty is fully transparent. Malformed RGB
+// values, which State.Validate reports, are black.
+func (p Palette) RGBA(c Color) color.RGBA {
+	if c == Empty {
+		return color.RGBA{}
+	}
+
+	rgba, err := parseRGB(p.RGB(c))
+	if err != nil {
+		return color.RGBA{A: 0xff}
+	}
+	return rgba
+}
+
+// Symbol returns the symbol of c, or "?" if c is not part of the palette.
+func (p Palette) Symbol(c Color) string {
+	if c == Empty {
+		return emptySymbol
+	}
+	if e, ok := p.entry(c); ok && e.Symbol != "" {
+		return e.Symbol
+	}
+	return "?"
+}
+
+// ColorByName returns the color called name. In addition to the names in the
+// palette, "Empty" and the "color#<n>" notation are accepted.
+func (p Palette) ColorByName(name string) (Color, error) {
+	if p == nil {
+		p = DefaultPalette
+	}
+
+	if name == emptyName {
+		return Empty, nil
+	}
+	for i, e := range p {
+		if e.Name == name {
+			return Color(i + 1), nil
+		}
+	}
+
+	i, err := strconv.Atoi(strings.TrimPrefix(name, "color#"))
+	if err != nil {
+		return Empty, fmt.Errorf("%q is not a valid color: %w", name, err)
+	}
+	return Color(i), nil
+}
+
+// ColorBySymbol returns the color whose symbol is sym.
+func (p Palette) ColorBySymbol(sym string) (Color, error) {
+	if p == nil {
+		p = DefaultPalette
+	}
+
+	if sym == emptySymbol {
+		return Empty, nil
+	}
+	for i, e := range p {
+		if e.Symbol == sym {
+			return Color(i + 1), nil
+		}
+	}
+	return Empty, fmt.Errorf("%q is not a valid color symbol", sym)
+}
+
+// FormatStep is like Step.String, but uses the color names of p.
+func (p Palette) FormatStep(s Step) string {
+	if s.Type == AddBottle {
+		return s.String()
+	}
+	return fmt.Sprintf("pour %2d onto %2d (%s)", s.From+1, s.To+1, p.Name(s.Color))
+}
+
+// MarshalStep is like Step.MarshalJSON, but uses the color names of p.
+func (p Palette) MarshalStep(s Step) ([]byte, error) {
+	return json.Marshal(s.toJSON(p))
+}
+
+// UnmarshalStep is like Step.UnmarshalJSON, but looks up color names in p.
+func (p Palette) UnmarshalStep(data []byte) (Step, error) {
+	var sj stepJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return Step{}, err
+	}
+
+	var s Step
+	if err := s.fromJSON(sj, p); err != nil {
+		return Step{}, err
+	}
+	return s, nil
+}
+
+// hsvToRGB converts a color from HSV to RGB. h is in degrees, s and v are in [0, 1].
+func hsvToRGB(h, s, v float64) (r, g, b uint8) {
+	h = math.Mod(h, 360)
+
+	c := v * s
+	hp := h / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+
+	var rf, gf, bf float64
+	switch {
+	case hp < 1:
+		rf, gf, bf = c, x, 0
+	case hp < 2:
+		rf, gf, bf = x, c, 0
+	case hp < 3:
+		rf, gf, bf = 0, c, x
+	case hp < 4:
+		rf, gf, bf = 0, x, c
+	case hp < 5:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+
+	m := v - c
+	return uint8((rf + m) * 255), uint8((gf + m) * 255), uint8((bf + m) * 255)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/octo/watersort"
+	"github.com/octo/watersort/render"
+)
+
+var (
+	input   = flag.String("input", "", "file to read the level from")
+	code    = flag.String("code", "", "level code to play instead of reading a file")
+	num     = flag.Int("num", 10, "number of colors of a random level, used without -input and -code")
+	size    = flag.Int("size", 4, "number of slots in each bottle of a random level")
+	ascii   = flag.Bool("ascii", false, "draw palette symbols instead of true-color blocks")
+	symbols = flag.Bool("symbols", false, "draw palette symbols onto the true-color blocks")
+	legend  = flag.Bool("legend", false, "list the symbol and name of each color below the bottles")
+)
+
+const help = "←/→ move  space select  1-9 bottle  u undo  y redo  r restart  e extra bottle  h hint  q quit"
+
+func main() {
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixMicro())
+
+	level, err := loadLevel()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatalln("cannot read key presses from the terminal:", err)
+	}
+
+	g := newGame(level)
+	err = g.run(os.Stdin, os.Stdout)
+	if rerr := restore(); rerr != nil && err == nil {
+		err = rerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if g.game.Won() {
+		fmt.Printf("Solved in %d moves.", g.game.Moves())
+		// The player may have used the extra bottle, so the shortest
+		// solution may use it, too.
+		steps, err := g.game.InitialState().Solve(watersort.AllowExtraBottle())
+		if err == nil {
+			fmt.Printf(" The shortest solution has %d moves.", len(steps))
+		}
+		fmt.Println()
+	}
+}
+
+func loadLevel() (watersort.State, error) {
+	if *code != "" {
+		level, err := watersort.DecodeCode(*code)
+		if err != nil {
+			return watersort.State{}, err
+		}
+		if err := level.Validate(); err != nil {
+			return watersort.State{}, err
+		}
+		return level, nil
+	}
+
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return watersort.State{}, err
+		}
+		defer f.Close()
+
+		level, err := watersort.LoadLevel(f)
+		if err != nil {
+			return watersort.State{}, fmt.Errorf("watersort.LoadLevel(): %w", err)
+		}
+		return level, nil
+	}
+
+	// Not every random level can be solved.
+	for {
+		level := watersort.RandomState(*num, *size)
+		if _, err := level.Solve(); err == nil {
+			return level, nil
+		} else if !errors.Is(err, watersort.ErrNoSolution) {
+			return watersort.State{}, err
+		}
+	}
+}
+
+// key is a key press relevant to the game.
+type key int
+
+const (
+	keyOther key = iota
+	keyLeft
+	keyRight
+	keySelect
+	keyCancel
+	keyQuit
+)
+
+// keyReader splits terminal input into key presses. Several key presses may
+// arrive with a single read, e.g. when typing fast or pasting.
+type keyReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// readKey reads one key press. Printable characters are returned as runes
+// with key set to keyOther.
+func (kr *keyReader) readKey() (key, rune, error) {
+	if len(kr.buf) == 0 {
+		var buf [64]byte
+		n, err := kr.r.Read(buf[:])
+		if err != nil {
+			return keyOther, 0, err
+		}
+		kr.buf = append(kr.buf, buf[:n]...)
+	}
+
+	in := kr.buf
+	consume := func(n int) { kr.buf = kr.buf[n:] }
+
+	switch {
+	case len(in) >= 3 && in[0] == 0x1b && in[1] == '[' && in[2] == 'C':
+		consume(3)
+		return keyRight, 0, nil
+	case len(in) >= 3 && in[0] == 0x1b && in[1] == '[' && in[2] == 'D':
+		consume(3)
+		return keyLeft, 0, nil
+	case len(in) >= 3 && in[0] == 0x1b && in[1] == '[':
+		// Other escape sequences, e.g. up and down.
+		consume(3)
+		return keyOther, 0, nil
+	}
+
+	consume(1)
+	switch in[0] {
+	case 0x1b:
+		return keyCancel, 0, nil
+	case ' ', '\r', '\n':
+		return keySelect, 0, nil
+	case 0x03, 0x04: // Ctrl-C, Ctrl-D
+		return keyQuit, 0, nil
+	default:
+		return keyOther, rune(in[0]), nil
+	}
+}
+
+// game is the state of the user interface.
+type game struct {
+	game   *watersort.Game
+	cursor int
+	// selected is the index of the source bottle, or -1.
+	selected int
+	message  string
+}
+
+func newGame(level watersort.State) *game {
+	return &game{
+		game:     watersort.NewGame(level),
+		selected: -1,
+	}
+}
+
+// run reads key presses from r and draws the game to w until the level is
+// solved or the player quits.
+func (g *game) run(r io.Reader, w io.Writer) error {
+	kr := keyReader{r: r}
+	for {
+		if err := g.draw(w); err != nil {
+			return err
+		}
+		if g.game.Won() {
+			return nil
+		}
+
+		k, ch, err := kr.readKey()
+		if err != nil {
+			return err
+		}
+
+		g.message = ""
+		n := len(g.game.State().Bottles)
+		switch {
+		case k == keyQuit || ch == 'q':
+			return nil
+		case k == keyLeft || ch == 'a':
+			g.cursor = (g.cursor + n - 1) % n
+		case k == keyRight || ch == 'd':
+			g.cursor = (g.cursor + 1) % n
+		case k == keySelect:
+			g.pick(g.cursor)
+		case k == keyCancel:
+			g.selected = -1
+		case ch >= '1' && ch <= '9':
+			if i := int(ch - '1'); i < n {
+				g.cursor = i
+				g.pick(i)
+			}
+		case ch == 'u':
+			g.selected = -1
+			if err := g.game.Undo(); err != nil {
+				g.message = err.Error()
+			}
+		case ch == 'y':
+			g.selected = -1
+			if err := g.game.Redo(); err != nil {
+				g.message = err.Error()
+			}
+		case ch == 'r':
+			g.selected = -1
+			g.cursor = 0
+			g.game.Restart()
+		case ch == 'e':
+			g.selected = -1
+			if err := g.game.Move(watersort.Step{Type: watersort.AddBottle}); err != nil {
+				g.message = err.Error()
+			}
+		case ch == 'h' || ch == '?':
+			g.hint()
+		}
+
+		// Undo and restart may remove an extra bottle.
+		if n := len(g.game.State().Bottles); g.cursor >= n {
+			g.cursor = n - 1
+		}
+		if g.message == "" && g.game.Stuck() {
+			g.message = "No moves left. Undo or restart."
+		}
+	}
+}
+
+// pick selects bottle i as the source, or pours the selected bottle into it.
+func (g *game) pick(i int) {
+	if g.selected == -1 {
+		if g.game.State().Bottles[i].TopColor() == watersort.Empty {
+			g.message = fmt.Sprintf("Bottle %d is empty.", i+1)
+			return
+		}
+		g.selected = i
+		return
+	}
+
+	from := g.selected
+	g.selected = -1
+	if from == i {
+		return
+	}
+
+	if err := g.game.Move(watersort.Step{From: from, To: i}); err != nil {
+		g.message = fmt.Sprintf("Cannot pour %d onto %d: %v", from+1, i+1, err)
+	}
+}
+
+// hint solves the current state and shows the first step.
+func (g *game) hint() {
+	s := g.game.State()
+
+	steps, err := s.Solve()
+	if errors.Is(err, watersort.ErrNoSolution) && g.game.ExtraBottlesLeft() > 0 {
+		steps, err = s.Solve(watersort.AllowExtraBottle())
+	}
+	if errors.Is(err, watersort.ErrNoSolution) {
+		g.message = "There is no solution from here. Undo or restart."
+		return
+	}
+	if err != nil {
+		g.message = err.Error()
+		return
+	}
+
+	g.message = "Hint: " + strings.Join(strings.Fields(s.Palette.FormatStep(steps[0])), " ")
+	if steps[0].Type == watersort.Pour {
+		g.cursor = steps[0].From
+		g.selected = -1
+	}
+}
+
+func (g *game) draw(w io.Writer) error {
+	s := g.game.State()
+
+	marks := map[int]string{g.cursor: " ^^"}
+	if g.selected != -1 {
+		marks[g.selected] = " **"
+		if g.selected == g.cursor {
+			marks[g.selected] = " *^"
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	if err := render.Terminal(&b, s, render.TerminalOptions{ASCII: *ascii, Symbols: *symbols, Legend: *legend, Marks: marks}); err != nil {
+		return err
+	}
+
+	undos := "unlimited"
+	if n := g.game.UndosLeft(); n >= 0 {
+		undos = fmt.Sprint(n)
+	}
+	fmt.Fprintf(&b, "\nMoves: %d   Undos left: %s   Extra bottles left: %d\n", g.game.Moves(), undos, g.game.ExtraBottlesLeft())
+
+	switch {
+	case g.game.Won():
+		b.WriteString("Solved!\n")
+	case g.message != "":
+		b.WriteString(g.message + "\n")
+	case g.selected != -1:
+		fmt.Fprintf(&b, "Pour %d onto …\n", g.selected+1)
+	default:
+		b.WriteString("\n")
+	}
+	b.WriteString("\n" + help + "\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func makeRaw(fd int) (restore func() error, err error) {
+	return nil, errors.New("raw terminal input is only supported on Linux")
+}
@@ -0,0 +1,168 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// DefaultDelay is the time each step of an animation is shown by default.
+const DefaultDelay = time.Second
+
+// GIFOptions control how a solution is animated.
+type GIFOptions struct {
+	// Delay is the time each step is shown. The solved state is shown three
+	// times as long. Defaults to DefaultDelay.
+	Delay time.Duration
+	// Highlight draws the source and destination of each step in different colors.
+	Highlight bool
+	// Captions describes each step below the bottles.
+	Captions bool
+	// PerRow is the number of bottles per row, see Options.
+	PerRow int
+	// Symbols, Legend and Theme are the same as in Options.
+	Symbols bool
+	Legend  bool
+	Theme   Theme
+}
+
+// GIF writes an animated GIF to w that shows steps being applied to s. Each
+// frame shows a state with an arrow for the next step; the last frame shows
+// the final state.
+func GIF(w io.Writer, s watersort.State, steps []watersort.Step, opts GIFOptions) error {
+	// Use the same number of bottles per row in all frames, even if a step
+	// adds a bottle.
+	perRow := opts.PerRow
+	if perRow <= 0 {
+		n := len(s.Bottles)
+		for _, step := range steps {
+			if step.Type == watersort.AddBottle {
+				n++
+			}
+		}
+		perRow = defaultPerRow(n)
+	}
+
+	// Frames grow when a bottle is added, and the GIF's palette must hold the
+	// colors of all frames. To keep only one frame in full color at a time,
+	// the frames are rendered twice: first to find the size and colors of the
+	// animation, then to convert each frame to the palette.
+	var (
+		bounds image.Rectangle
+		colors frameColors
+	)
+	err := eachFrame(s, steps, opts, perRow, func(f *image.RGBA, _ time.Duration) {
+		bounds = bounds.Union(f.Bounds())
+		colors.add(f)
+	})
+	if err != nil {
+		return err
+	}
+
+	p := colors.palette()
+	anim := &gif.GIF{
+		Config: image.Config{
+			ColorModel: p,
+			Width:      bounds.Dx(),
+			Height:     bounds.Dy(),
+		},
+	}
+	err = eachFrame(s, steps, opts, perRow, func(f *image.RGBA, d time.Duration) {
+		pi := image.NewPaletted(bounds, p)
+		draw.Draw(pi, bounds, &image.Uniform{opts.Theme.colors().background}, image.Point{}, draw.Src)
+		draw.Draw(pi, f.Bounds(), f, f.Bounds().Min, draw.Src)
+		anim.Image = append(anim.Image, pi)
+		anim.Delay = append(anim.Delay, int(d/(10*time.Millisecond)))
+	})
+	if err != nil {
+		return err
+	}
+
+	return gif.EncodeAll(w, anim)
+}
+
+// eachFrame renders the frames of steps being applied to s and calls f with
+// each frame and the time it is shown.
+func eachFrame(s watersort.State, steps []watersort.Step, opts GIFOptions, perRow int, f func(*image.RGBA, time.Duration)) error {
+	delay := opts.Delay
+	if delay <= 0 {
+		delay = DefaultDelay
+	}
+
+	s = s.Clone()
+	for i := 0; i <= len(steps); i++ {
+		ro := Options{
+			Highlight: opts.Highlight,
+			PerRow:    perRow,
+			Symbols:   opts.Symbols,
+			Legend:    opts.Legend,
+			Theme:     opts.Theme,
+		}
+		d := delay
+		if i < len(steps) {
+			ro.Step = &steps[i]
+			if opts.Captions {
+				ro.Caption = fmt.Sprintf("Step %d/%d: %s", i+1, len(steps), s.Palette.FormatStep(steps[i]))
+			}
+		} else {
+			d = 3 * delay
+			if opts.Captions {
+				ro.Caption = fmt.Sprintf("Done after %d steps", len(steps))
+			}
+		}
+
+		f(Image(s, ro), d)
+
+		if i < len(steps) {
+			if err := s.Apply(steps[i]); err != nil {
+				return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(steps[i]), err)
+			}
+		}
+	}
+	return nil
+}
+
+// frameColors collects the colors used in frames. Frames are not
+// anti-aliased, so there are usually few colors. If there are more than a
+// GIF can hold, a generic palette is used.
+type frameColors struct {
+	seen    map[color.RGBA]bool
+	colors  color.Palette
+	tooMany bool
+}
+
+func (fc *frameColors) add(f *image.RGBA) {
+	if fc.seen == nil {
+		fc.seen = make(map[color.RGBA]bool)
+	}
+
+	b := f.Bounds()
+	for y := b.Min.Y; y < b.Max.Y && !fc.tooMany; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := f.RGBAAt(x, y)
+			if fc.seen[c] {
+				continue
+			}
+			if len(fc.colors) == 256 {
+				fc.tooMany = true
+				break
+			}
+			fc.seen[c] = true
+			fc.colors = append(fc.colors, c)
+		}
+	}
+}
+
+func (fc *frameColors) palette() color.Palette {
+	if fc.tooMany {
+		return palette.Plan9
+	}
+	return fc.colors
+}
@@ -0,0 +1,77 @@
+package render
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+)
+
+func TestGIF(t *testing.T) {
+	steps := []watersort.Step{
+		{From: 0, To: 2},
+		{From: 1, To: 0},
+		{From: 1, To: 2},
+	}
+	if err := level.Replay(steps); err != nil {
+		t.Fatalf("Replay(): %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		steps []watersort.Step
+		opts  GIFOptions
+		want  []int
+	}{
+		{
+			name:  "default delay",
+			steps: steps,
+			want:  []int{100, 100, 100, 300},
+		},
+		{
+			name:  "custom delay",
+			steps: steps,
+			opts:  GIFOptions{Delay: 250 * time.Millisecond, Highlight: true, Captions: true},
+			want:  []int{25, 25, 25, 75},
+		},
+		{
+			name:  "extra bottle",
+			steps: append([]watersort.Step{{Type: watersort.AddBottle}}, steps...),
+			opts:  GIFOptions{Captions: true},
+			want:  []int{100, 100, 100, 100, 300},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := GIF(&buf, level, tc.steps, tc.opts); err != nil {
+				t.Fatalf("GIF(): %v", err)
+			}
+
+			g, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("gif.DecodeAll(): %v", err)
+			}
+
+			if diff := cmp.Diff(tc.want, g.Delay); diff != "" {
+				t.Errorf("GIF() delays differ (-want/+got):\n%s", diff)
+			}
+			for i, img := range g.Image {
+				if got, want := img.Bounds().Size(), g.Image[len(g.Image)-1].Bounds().Size(); got != want {
+					t.Errorf("frame %d size = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGIF_InvalidStep(t *testing.T) {
+	steps := []watersort.Step{{From: 2, To: 0}}
+	if err := GIF(&bytes.Buffer{}, level, steps, GIFOptions{}); err == nil {
+		t.Errorf("GIF() with an invalid step succeeded, want error")
+	}
+}
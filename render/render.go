@@ -0,0 +1,480 @@
+// Package render draws water sort states as SVG and PNG images.
+package render
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/octo/watersort"
+)
+
+// Options control how a state is drawn.
+type Options struct {
+	// Step, if not nil, is drawn as an arrow from the source to the
+	// destination bottle.
+	Step *watersort.Step
+	// Highlight draws the outlines of the source and destination of Step in
+	// different colors.
+	Highlight bool
+	// Caption, if not empty, is drawn below the bottles.
+	Caption string
+	// PerRow is the number of bottles per row. By default, up to seven bottles
+	// are drawn in a single row and larger levels in two rows, like in the game.
+	PerRow int
+	// Symbols draws the palette's symbol of each color onto the water, so
+	// that colors can be told apart without seeing their hue.
+	Symbols bool
+	// Legend lists the symbol and name of each color below the bottles.
+	Legend bool
+	// Theme selects the colors of the background, outlines and arrows.
+	Theme Theme
+}
+
+// Theme selects the colors of everything but the water.
+type Theme int
+
+const (
+	DefaultTheme Theme = iota
+	// HighContrast draws white outlines on black and highlights the source
+	// and destination of a step in orange and blue, which can be told apart
+	// with the common kinds of color blindness.
+	HighContrast
+)
+
+var themeNames = map[Theme]string{
+	DefaultTheme: "default",
+	HighContrast: "high-contrast",
+}
+
+func (t Theme) String() string {
+	if name, ok := themeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Theme(%d)", int(t))
+}
+
+// ParseTheme returns the theme called name, e.g. "high-contrast".
+func ParseTheme(name string) (Theme, error) {
+	for t, n := range themeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return DefaultTheme, fmt.Errorf("unknown theme %q", name)
+}
+
+type themeColors struct {
+	background, outline, arrow, source, target, text color.RGBA
+}
+
+func (t Theme) colors() themeColors {
+	if t == HighContrast {
+		return themeColors{
+			background: color.RGBA{0x00, 0x00, 0x00, 0xff},
+			outline:    color.RGBA{0xff, 0xff, 0xff, 0xff},
+			arrow:      color.RGBA{0xff, 0xff, 0x00, 0xff},
+			source:     color.RGBA{0xff, 0x99, 0x00, 0xff},
+			target:     color.RGBA{0x33, 0xa0, 0xff, 0xff},
+			text:       color.RGBA{0xff, 0xff, 0xff, 0xff},
+		}
+	}
+	return themeColors{
+		background: backgroundColor,
+		outline:    outlineColor,
+		arrow:      arrowColor,
+		source:     sourceColor,
+		target:     targetColor,
+		text:       captionColor,
+	}
+}
+
+// symbolColor returns black or white, whichever is easier to read on c.
+func symbolColor(c color.RGBA) color.RGBA {
+	luminance := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	if luminance > 140 {
+		return color.RGBA{0x00, 0x00, 0x00, 0xff}
+	}
+	return color.RGBA{0xff, 0xff, 0xff, 0xff}
+}
+
+const (
+	slotWidth    = 40
+	slotHeight   = 30
+	outlineWidth = 3
+	gap          = 30
+	// arrowSpace is the space above each row of bottles reserved for arrows.
+	arrowSpace = 60
+	// captionHeight is the height of the caption area below the bottles.
+	captionHeight = 30
+	// Each legend entry is a swatch followed by the color's name.
+	legendRowHeight = 28
+	swatchWidth     = 30
+	swatchHeight    = 20
+	swatchSpacing   = 8
+)
+
+var (
+	backgroundColor = color.RGBA{0x20, 0x20, 0x30, 0xff}
+	outlineColor    = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	arrowColor      = color.RGBA{0xff, 0xd7, 0x00, 0xff}
+	sourceColor     = color.RGBA{0xff, 0x60, 0x60, 0xff}
+	targetColor     = color.RGBA{0x60, 0xe0, 0x60, 0xff}
+	captionColor    = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// layout holds the geometry shared by the SVG and PNG renderers.
+type layout struct {
+	size    image.Point
+	caption image.Rectangle
+	legend  []legendEntry
+	bottles []image.Rectangle
+	// slots holds the rectangle of each slot, bottom to top.
+	slots [][]image.Rectangle
+}
+
+type legendEntry struct {
+	color  watersort.Color
+	swatch image.Rectangle
+	label  image.Rectangle
+}
+
+func newLayout(s watersort.State, opts Options) layout {
+	n := len(s.Bottles)
+	perRow := opts.PerRow
+	if perRow <= 0 {
+		perRow = defaultPerRow(n)
+	}
+	rows := (n + perRow - 1) / perRow
+
+	var bottleSize int
+	if n > 0 {
+		bottleSize = s.BottleSize()
+	}
+	// The inner height includes a tenth of head space above the highest slot.
+	inner := image.Rect(0, 0, slotWidth, bottleSize*slotHeight*10/9)
+	bottle := inner.Inset(-outlineWidth)
+	bottle = bottle.Sub(bottle.Min)
+
+	l := layout{
+		size: image.Pt(gap+perRow*(bottle.Dx()+gap), rows*(arrowSpace+bottle.Dy()+gap)),
+	}
+	if opts.Legend {
+		l.addLegend(s)
+	}
+	if opts.Caption != "" {
+		l.caption = image.Rect(0, l.size.Y, l.size.X, l.size.Y+captionHeight)
+		l.size.Y += captionHeight
+	}
+
+	for i, b := range s.Bottles {
+		origin := image.Pt(gap+(i%perRow)*(bottle.Dx()+gap), arrowSpace+(i/perRow)*(arrowSpace+bottle.Dy()+gap))
+		r := bottle.Add(origin)
+		l.bottles = append(l.bottles, r)
+
+		in := r.Inset(outlineWidth)
+		var slots []image.Rectangle
+		for j := range b.Colors {
+			slots = append(slots, image.Rect(in.Min.X, in.Max.Y-(j+1)*slotHeight, in.Max.X, in.Max.Y-j*slotHeight))
+		}
+		l.slots = append(l.slots, slots)
+	}
+
+	return l
+}
+
+// addLegend adds an entry for each color used in s below the bottles. The
+// entries are laid out in columns wide enough for the longest name.
+func (l *layout) addLegend(s watersort.State) {
+	colors := s.Colors()
+
+	labelWidth := 0
+	for _, c := range colors {
+		if w := textWidth(s.Palette.Name(c), 2); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	cellWidth := swatchWidth + swatchSpacing + labelWidth + gap
+	cols := (l.size.X - gap) / cellWidth
+	if cols < 1 {
+		cols = 1
+		labelWidth = l.size.X - 2*gap - swatchWidth - swatchSpacing
+	}
+
+	top := l.size.Y
+	for i, c := range colors {
+		origin := image.Pt(gap+(i%cols)*cellWidth, top+(i/cols)*legendRowHeight)
+		swatch := image.Rect(0, 0, swatchWidth, swatchHeight).Add(origin)
+		l.legend = append(l.legend, legendEntry{
+			color:  c,
+			swatch: swatch,
+			label:  image.Rect(swatch.Max.X+swatchSpacing, swatch.Min.Y, swatch.Max.X+swatchSpacing+labelWidth, swatch.Max.Y),
+		})
+	}
+	rows := (len(colors) + cols - 1) / cols
+	l.size.Y += rows*legendRowHeight + gap/2
+}
+
+// defaultPerRow returns the number of bottles per row for n bottles.
+func defaultPerRow(n int) int {
+	switch {
+	case n == 0:
+		return 1
+	case n > 7:
+		return (n + 1) / 2
+	default:
+		return n
+	}
+}
+
+// outline returns the outline color of bottle i.
+func outline(i int, opts Options) color.RGBA {
+	tc := opts.Theme.colors()
+	if opts.Highlight && opts.Step != nil && opts.Step.Type == watersort.Pour {
+		switch i {
+		case opts.Step.From:
+			return tc.source
+		case opts.Step.To:
+			return tc.target
+		}
+	}
+	return tc.outline
+}
+
+// BottleLabel describes bottle i for screen readers, e.g.
+// "Bottle 1: Red, Blue, Empty, Empty (bottom to top)".
+func BottleLabel(p watersort.Palette, i int, b watersort.Bottle) string {
+	names := make([]string, len(b.Colors))
+	for j, c := range b.Colors {
+		names[j] = p.Name(c)
+	}
+	return fmt.Sprintf("Bottle %d: %s (bottom to top)", i+1, strings.Join(names, ", "))
+}
+
+// arrow returns the start, control and end point of a quadratic Bézier curve
+// from the top of bottle "from" to the top of bottle "to".
+func (l layout) arrow(step watersort.Step) (start, ctrl, end image.Point, ok bool) {
+	if step.Type != watersort.Pour || step.From < 0 || step.From >= len(l.bottles) ||
+		step.To < 0 || step.To >= len(l.bottles) || step.From == step.To {
+		return image.Point{}, image.Point{}, image.Point{}, false
+	}
+
+	from, to := l.bottles[step.From], l.bottles[step.To]
+	start = image.Pt((from.Min.X+from.Max.X)/2, from.Min.Y-5)
+	end = image.Pt((to.Min.X+to.Max.X)/2, to.Min.Y-5)
+
+	top := start.Y
+	if end.Y < top {
+		top = end.Y
+	}
+	ctrl = image.Pt((start.X+end.X)/2, top-arrowSpace+10)
+	if ctrl.Y < 5 {
+		ctrl.Y = 5
+	}
+
+	return start, ctrl, end, true
+}
+
+// SVG writes s as an SVG image to w. Each bottle has a title describing its
+// colors, for screen readers and tooltips.
+func SVG(w io.Writer, s watersort.State, opts Options) error {
+	l := newLayout(s, opts)
+	tc := opts.Theme.colors()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-labelledby="svg-title">`+"\n",
+		l.size.X, l.size.Y, l.size.X, l.size.Y)
+	title := fmt.Sprintf("Water sort level with %d bottles", len(s.Bottles))
+	if opts.Step != nil {
+		title += ", next step: " + strings.Join(strings.Fields(s.Palette.FormatStep(*opts.Step)), " ")
+	}
+	fmt.Fprintf(&b, `<title id="svg-title">%s</title>`+"\n", html.EscapeString(title))
+	fmt.Fprintf(&b, `<defs><marker id="arrowhead" markerWidth="6" markerHeight="6" refX="3" refY="3" orient="auto">`+
+		`<path d="M0,0 L6,3 L0,6 z" fill="%s"/></marker></defs>`+"\n", hex(tc.arrow))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hex(tc.background))
+
+	for i, bottle := range s.Bottles {
+		fmt.Fprintf(&b, `<g class="bottle" id="bottle-%d">`+"\n", i+1)
+		fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(BottleLabel(s.Palette, i, bottle)))
+		for j, c := range bottle.Colors {
+			if c == watersort.Empty {
+				continue
+			}
+			svgSlot(&b, l.slots[i][j], s.Palette, c, opts.Symbols)
+		}
+
+		// The stroke is centered on the path, so inset it by half its width.
+		r := l.bottles[i]
+		fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" fill="none" stroke="%s" stroke-width="%d"/>`+"\n",
+			float64(r.Min.X)+outlineWidth/2.0, float64(r.Min.Y)+outlineWidth/2.0,
+			float64(r.Dx()-outlineWidth), float64(r.Dy()-outlineWidth), hex(outline(i, opts)), outlineWidth)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s" font-family="sans-serif" font-size="14" text-anchor="middle">%d</text>`+"\n",
+			(r.Min.X+r.Max.X)/2, r.Max.Y+18, hex(tc.outline), i+1)
+		b.WriteString("</g>\n")
+	}
+
+	if opts.Step != nil {
+		if start, ctrl, end, ok := l.arrow(*opts.Step); ok {
+			fmt.Fprintf(&b, `<path d="M%d,%d Q%d,%d %d,%d" fill="none" stroke="%s" stroke-width="4" marker-end="url(#arrowhead)"/>`+"\n",
+				start.X, start.Y, ctrl.X, ctrl.Y, end.X, end.Y, hex(tc.arrow))
+		}
+	}
+
+	for _, e := range l.legend {
+		b.WriteString(`<g class="legend">` + "\n")
+		svgSlot(&b, e.swatch, s.Palette, e.color, true)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s" font-family="sans-serif" font-size="16">%s</text>`+"\n",
+			e.label.Min.X, e.label.Max.Y-4, hex(tc.text), html.EscapeString(s.Palette.Name(e.color)))
+		b.WriteString("</g>\n")
+	}
+
+	if opts.Caption != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s" font-family="sans-serif" font-size="16" text-anchor="middle">%s</text>`+"\n",
+			l.caption.Dx()/2, l.caption.Min.Y+20, hex(tc.text), html.EscapeString(opts.Caption))
+	}
+
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// svgSlot writes a rectangle filled with c, optionally with c's symbol.
+func svgSlot(b *strings.Builder, r image.Rectangle, p watersort.Palette, c watersort.Color, symbol bool) {
+	fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+		r.Min.X, r.Min.Y, r.Dx(), r.Dy(), html.EscapeString(p.RGB(c)))
+	if symbol {
+		fmt.Fprintf(b, `<text x="%d" y="%d" fill="%s" font-family="monospace" font-size="16" font-weight="bold" text-anchor="middle" dominant-baseline="central">%s</text>`+"\n",
+			(r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2, hex(symbolColor(p.RGBA(c))), html.EscapeString(p.Symbol(c)))
+	}
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Image draws s into a new RGBA image.
+func Image(s watersort.State, opts Options) *image.RGBA {
+	l := newLayout(s, opts)
+	tc := opts.Theme.colors()
+
+	img := image.NewRGBA(image.Rectangle{Max: l.size})
+	draw.Draw(img, img.Bounds(), &image.Uniform{tc.background}, image.Point{}, draw.Src)
+
+	for i, bottle := range s.Bottles {
+		r := l.bottles[i]
+		draw.Draw(img, r, &image.Uniform{outline(i, opts)}, image.Point{}, draw.Src)
+		draw.Draw(img, r.Inset(outlineWidth), &image.Uniform{tc.background}, image.Point{}, draw.Src)
+
+		for j, c := range bottle.Colors {
+			if c == watersort.Empty {
+				continue
+			}
+			drawSlot(img, l.slots[i][j], s.Palette, c, opts.Symbols)
+		}
+	}
+
+	if opts.Step != nil {
+		if start, ctrl, end, ok := l.arrow(*opts.Step); ok {
+			drawArrow(img, start, ctrl, end, tc.arrow)
+		}
+	}
+
+	for _, e := range l.legend {
+		drawSlot(img, e.swatch, s.Palette, e.color, true)
+		// Align the name to the left by drawing it into a rectangle of its size.
+		label := e.label
+		if w := textWidth(s.Palette.Name(e.color), 2); w < label.Dx() {
+			label.Max.X = label.Min.X + w
+		}
+		drawText(img, label, s.Palette.Name(e.color), tc.text)
+	}
+
+	if opts.Caption != "" {
+		drawText(img, l.caption, opts.Caption, tc.text)
+	}
+
+	return img
+}
+
+// drawSlot fills r with c, optionally with c's symbol.
+func drawSlot(img draw.Image, r image.Rectangle, p watersort.Palette, c watersort.Color, symbol bool) {
+	rgba := p.RGBA(c)
+	draw.Draw(img, r, &image.Uniform{rgba}, image.Point{}, draw.Src)
+	if symbol {
+		drawText(img, r, p.Symbol(c), symbolColor(rgba))
+	}
+}
+
+// PNG writes s as a PNG image to w.
+func PNG(w io.Writer, s watersort.State, opts Options) error {
+	return png.Encode(w, Image(s, opts))
+}
+
+// drawArrow draws a quadratic Bézier curve with an arrowhead at its end.
+func drawArrow(img draw.Image, start, ctrl, end image.Point, c color.Color) {
+	const (
+		radius    = 2
+		headSize  = 12
+		headAngle = math.Pi / 7
+	)
+
+	bezier := func(t float64) (float64, float64) {
+		u := 1 - t
+		x := u*u*float64(start.X) + 2*u*t*float64(ctrl.X) + t*t*float64(end.X)
+		y := u*u*float64(start.Y) + 2*u*t*float64(ctrl.Y) + t*t*float64(end.Y)
+		return x, y
+	}
+
+	// The control polygon is at least as long as the curve; stamp a circle
+	// at least every pixel.
+	segments := int(math.Hypot(float64(ctrl.X-start.X), float64(ctrl.Y-start.Y)) +
+		math.Hypot(float64(end.X-ctrl.X), float64(end.Y-ctrl.Y)) + 1)
+	for i := 0; i <= segments; i++ {
+		x, y := bezier(float64(i) / float64(segments))
+		fillCircle(img, x, y, radius, c)
+	}
+
+	// The arrowhead points along the tangent at the end of the curve.
+	angle := math.Atan2(float64(end.Y-ctrl.Y), float64(end.X-ctrl.X))
+	tip := [2]float64{float64(end.X), float64(end.Y)}
+	left := [2]float64{tip[0] - headSize*math.Cos(angle-headAngle), tip[1] - headSize*math.Sin(angle-headAngle)}
+	right := [2]float64{tip[0] - headSize*math.Cos(angle+headAngle), tip[1] - headSize*math.Sin(angle+headAngle)}
+	fillTriangle(img, tip, left, right, c)
+}
+
+func fillCircle(img draw.Image, cx, cy, r float64, c color.Color) {
+	for y := int(cy - r); y <= int(cy+r); y++ {
+		for x := int(cx - r); x <= int(cx+r); x++ {
+			if dx, dy := float64(x)-cx, float64(y)-cy; dx*dx+dy*dy <= r*r {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+func fillTriangle(img draw.Image, a, b, p [2]float64, c color.Color) {
+	minX := math.Floor(math.Min(a[0], math.Min(b[0], p[0])))
+	maxX := math.Ceil(math.Max(a[0], math.Max(b[0], p[0])))
+	minY := math.Floor(math.Min(a[1], math.Min(b[1], p[1])))
+	maxY := math.Ceil(math.Max(a[1], math.Max(b[1], p[1])))
+
+	edge := func(u, v [2]float64, x, y float64) float64 {
+		return (v[0]-u[0])*(y-u[1]) - (v[1]-u[1])*(x-u[0])
+	}
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			e0, e1, e2 := edge(a, b, x, y), edge(b, p, x, y), edge(p, a, x, y)
+			if (e0 >= 0 && e1 >= 0 && e2 >= 0) || (e0 <= 0 && e1 <= 0 && e2 <= 0) {
+				img.Set(int(x), int(y), c)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/octo/watersort"
+)
+
+var level = watersort.State{
+	Bottles: []watersort.Bottle{
+		{Colors: []watersort.Color{watersort.Red, watersort.Green}},
+		{Colors: []watersort.Color{watersort.Green, watersort.Red}},
+		{Colors: []watersort.Color{watersort.Empty, watersort.Empty}},
+	},
+}
+
+func TestImage(t *testing.T) {
+	img := Image(level, Options{})
+	l := newLayout(level, Options{})
+
+	if got, want := img.Bounds().Size(), l.size; got != want {
+		t.Errorf("Image() size = %v, want %v", got, want)
+	}
+
+	for i, b := range level.Bottles {
+		for j, c := range b.Colors {
+			center := l.slots[i][j].Min.Add(l.slots[i][j].Size().Div(2))
+			want := level.Palette.RGBA(c)
+			if c == watersort.Empty {
+				want = backgroundColor
+			}
+			if got := img.RGBAAt(center.X, center.Y); got != want {
+				t.Errorf("bottle %d, slot %d: color = %v, want %v", i+1, j+1, got, want)
+			}
+		}
+
+		if got := img.RGBAAt(l.bottles[i].Min.X, l.bottles[i].Max.Y-1); got != outlineColor {
+			t.Errorf("bottle %d: outline color = %v, want %v", i+1, got, outlineColor)
+		}
+	}
+}
+
+func TestImage_Arrow(t *testing.T) {
+	step := watersort.Step{From: 0, To: 2, Color: watersort.Green}
+
+	without := Image(level, Options{})
+	with := Image(level, Options{Step: &step})
+
+	// The arrow is drawn in the space above the bottles.
+	above := image.Rect(0, 0, without.Bounds().Dx(), arrowSpace)
+	if countColor(without, above, arrowColor) != 0 {
+		t.Errorf("Image() without a step contains arrow pixels")
+	}
+	if countColor(with, above, arrowColor) == 0 {
+		t.Errorf("Image() with a step contains no arrow pixels")
+	}
+}
+
+func countColor(img *image.RGBA, r image.Rectangle, c color.RGBA) int {
+	var n int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.RGBAAt(x, y) == c {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PNG(&buf, level, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode(): %v", err)
+	}
+	if got, want := img.Bounds(), Image(level, Options{}).Bounds(); got != want {
+		t.Errorf("PNG() bounds = %v, want %v", got, want)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	palette := watersort.Palette{
+		{Name: "Teal", RGB: "#008080"},
+		{Name: "Rose", RGB: "#ff0080"},
+	}
+	s := watersort.State{
+		Bottles: []watersort.Bottle{
+			{Colors: []watersort.Color{1, 2}},
+			{Colors: []watersort.Color{2, 1}},
+			{Colors: []watersort.Color{watersort.Empty, watersort.Empty}},
+		},
+		Palette: palette,
+	}
+
+	var buf bytes.Buffer
+	if err := SVG(&buf, s, Options{Step: &watersort.Step{From: 0, To: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"<svg ",
+		`fill="#008080"`,
+		`fill="#ff0080"`,
+		`id="bottle-3"`,
+		`marker-end="url(#arrowhead)"`,
+		"</svg>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("SVG() does not contain %q", want)
+		}
+	}
+}
+
+func TestSVG_Escape(t *testing.T) {
+	s := watersort.State{
+		Bottles: []watersort.Bottle{
+			{Colors: []watersort.Color{1}},
+			{Colors: []watersort.Color{watersort.Empty}},
+		},
+		Palette: watersort.Palette{
+			{Name: "<b>Red</b>", RGB: `red"/><script>alert(1)</script><rect fill="red`, Symbol: "<"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := SVG(&buf, s, Options{Symbols: true, Legend: true, Caption: "<i>"}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, unwanted := range []string{"<script>", "<b>", "<i>", `fill="red"`} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("SVG() contains %q", unwanted)
+		}
+	}
+}
+
+func TestImage_Highlight(t *testing.T) {
+	step := watersort.Step{From: 0, To: 2}
+	img := Image(level, Options{Step: &step, Highlight: true, Caption: "Step 1/3"})
+	l := newLayout(level, Options{Caption: "Step 1/3"})
+
+	for i, want := range []color.RGBA{sourceColor, outlineColor, targetColor} {
+		if got := img.RGBAAt(l.bottles[i].Min.X, l.bottles[i].Max.Y-1); got != want {
+			t.Errorf("bottle %d: outline color = %v, want %v", i+1, got, want)
+		}
+	}
+
+	if countColor(img, l.caption, captionColor) == 0 {
+		t.Errorf("Image() caption area contains no text")
+	}
+}
+
+func TestImage_Symbols(t *testing.T) {
+	img := Image(level, Options{Symbols: true})
+	l := newLayout(level, Options{Symbols: true})
+
+	for i, b := range level.Bottles {
+		for j, c := range b.Colors {
+			if c == watersort.Empty {
+				continue
+			}
+			want := symbolColor(level.Palette.RGBA(c))
+			if countColor(img, l.slots[i][j], want) == 0 {
+				t.Errorf("bottle %d, slot %d: no symbol pixels", i+1, j+1)
+			}
+		}
+	}
+}
+
+func TestImage_Legend(t *testing.T) {
+	without := newLayout(level, Options{})
+	l := newLayout(level, Options{Legend: true})
+
+	if got, want := len(l.legend), 2; got != want {
+		t.Fatalf("len(legend) = %d, want %d", got, want)
+	}
+	if l.size.Y <= without.size.Y {
+		t.Errorf("legend height = %d, want > %d", l.size.Y, without.size.Y)
+	}
+
+	img := Image(level, Options{Legend: true})
+	for _, e := range l.legend {
+		center := e.swatch.Min.Add(e.swatch.Size().Div(2))
+		if got, want := img.RGBAAt(e.swatch.Min.X, center.Y), level.Palette.RGBA(e.color); got != want {
+			t.Errorf("swatch of %v: color = %v, want %v", e.color, got, want)
+		}
+		if countColor(img, e.label, captionColor) == 0 {
+			t.Errorf("label of %v contains no text", e.color)
+		}
+	}
+}
+
+func TestImage_HighContrast(t *testing.T) {
+	step := watersort.Step{From: 0, To: 2}
+	opts := Options{Step: &step, Highlight: true, Theme: HighContrast}
+	img := Image(level, opts)
+	l := newLayout(level, opts)
+	tc := HighContrast.colors()
+
+	if got := img.RGBAAt(0, 0); got != tc.background {
+		t.Errorf("background color = %v, want %v", got, tc.background)
+	}
+	for i, want := range []color.RGBA{tc.source, tc.outline, tc.target} {
+		if got := img.RGBAAt(l.bottles[i].Min.X, l.bottles[i].Max.Y-1); got != want {
+			t.Errorf("bottle %d: outline color = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	for _, theme := range []Theme{DefaultTheme, HighContrast} {
+		got, err := ParseTheme(theme.String())
+		if err != nil || got != theme {
+			t.Errorf("ParseTheme(%q) = (%v, %v), want (%v, nil)", theme.String(), got, err, theme)
+		}
+	}
+	if _, err := ParseTheme("neon"); err == nil {
+		t.Errorf("ParseTheme(%q) succeeded, want error", "neon")
+	}
+}
+
+func TestSVG_Accessible(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SVG(&buf, level, Options{Symbols: true, Legend: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`role="img"`,
+		"<title>Bottle 1: " + level.Palette.Name(watersort.Red) + ", " + level.Palette.Name(watersort.Green),
+		"<title>Bottle 3: Empty, Empty (bottom to top)</title>",
+		">" + level.Palette.Symbol(watersort.Red) + "</text>",
+		`<g class="legend">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("SVG() does not contain %q", want)
+		}
+	}
+}
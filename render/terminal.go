@@ -0,0 +1,116 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/octo/watersort"
+)
+
+// TerminalOptions control how a state is drawn on a terminal.
+type TerminalOptions struct {
+	// ASCII draws colors as their palette symbols instead of using ANSI
+	// true-color escape sequences.
+	ASCII bool
+	// Marks are drawn below the number of the bottle with the given index,
+	// e.g. to show a cursor. Marks are at most four characters wide.
+	Marks map[int]string
+	// PerRow is the number of bottles per row, see Options.
+	PerRow int
+	// Symbols draws the palette symbols onto the colors when using escape
+	// sequences. ASCII always uses symbols.
+	Symbols bool
+	// Legend lists the symbol and name of each color below the bottles.
+	Legend bool
+}
+
+// Terminal writes s as text to w. Bottles are drawn side by side, each slot
+// two characters wide, with bottle numbers below:
+//
+//	|  | |  | |  |
+//	|RR| |  | |GG|
+//	|GG| |RR| |GG|
+//	+--+ +--+ +--+
+//	 1    2    3
+func Terminal(w io.Writer, s watersort.State, opts TerminalOptions) error {
+	perRow := opts.PerRow
+	if perRow <= 0 {
+		perRow = defaultPerRow(len(s.Bottles))
+	}
+
+	var b strings.Builder
+	for first := 0; first < len(s.Bottles); first += perRow {
+		last := first + perRow
+		if last > len(s.Bottles) {
+			last = len(s.Bottles)
+		}
+		if first != 0 {
+			b.WriteString("\n")
+		}
+		writeTerminalRow(&b, s, first, last, opts)
+	}
+
+	if opts.Legend {
+		var entries []string
+		for _, e := range newLayout(s, Options{Legend: true}).legend {
+			entries = append(entries, terminalSlot(s.Palette, e.color, opts)+" "+s.Palette.Name(e.color))
+		}
+		b.WriteString("\n" + strings.Join(entries, "  ") + "\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTerminalRow(b *strings.Builder, s watersort.State, first, last int, opts TerminalOptions) {
+	height := 0
+	for _, bottle := range s.Bottles[first:last] {
+		if len(bottle.Colors) > height {
+			height = len(bottle.Colors)
+		}
+	}
+
+	writeLine := func(cell func(i int) string) {
+		var cells []string
+		for i := first; i < last; i++ {
+			cells = append(cells, cell(i))
+		}
+		b.WriteString(strings.TrimRight(strings.Join(cells, " "), " "))
+		b.WriteString("\n")
+	}
+
+	// Row "height" is the head space above the highest slot.
+	for row := height; row >= 0; row-- {
+		writeLine(func(i int) string {
+			colors := s.Bottles[i].Colors
+			switch {
+			case row > len(colors):
+				return "    "
+			case row == len(colors) || colors[row] == watersort.Empty:
+				return "|  |"
+			default:
+				return "|" + terminalSlot(s.Palette, colors[row], opts) + "|"
+			}
+		})
+	}
+	writeLine(func(int) string { return "+--+" })
+	writeLine(func(i int) string { return fmt.Sprintf("%2d  ", i+1) })
+	if len(opts.Marks) > 0 {
+		writeLine(func(i int) string { return fmt.Sprintf("%-4s", opts.Marks[i]) })
+	}
+}
+
+func terminalSlot(p watersort.Palette, c watersort.Color, opts TerminalOptions) string {
+	sym := strings.Repeat(string([]rune(p.Symbol(c))[0]), 2)
+	if opts.ASCII {
+		return sym
+	}
+
+	rgba := p.RGBA(c)
+	if opts.Symbols {
+		fg := symbolColor(rgba)
+		return fmt.Sprintf("\x1b[48;2;%d;%d;%dm\x1b[38;2;%d;%d;%dm%s\x1b[0m", rgba.R, rgba.G, rgba.B, fg.R, fg.G, fg.B, sym)
+	}
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm██\x1b[0m", rgba.R, rgba.G, rgba.B)
+}
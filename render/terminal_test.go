@@ -0,0 +1,98 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+)
+
+func TestTerminal(t *testing.T) {
+	cases := []struct {
+		name string
+		opts TerminalOptions
+		want string
+	}{
+		{
+			name: "ASCII",
+			opts: TerminalOptions{ASCII: true},
+			want: "|  | |  | |  |\n" +
+				"|GG| |RR| |  |\n" +
+				"|RR| |GG| |  |\n" +
+				"+--+ +--+ +--+\n" +
+				" 1    2    3\n",
+		},
+		{
+			name: "two rows",
+			opts: TerminalOptions{ASCII: true, PerRow: 2},
+			want: "|  | |  |\n" +
+				"|GG| |RR|\n" +
+				"|RR| |GG|\n" +
+				"+--+ +--+\n" +
+				" 1    2\n" +
+				"\n" +
+				"|  |\n" +
+				"|  |\n" +
+				"|  |\n" +
+				"+--+\n" +
+				" 3\n",
+		},
+		{
+			name: "marks",
+			opts: TerminalOptions{ASCII: true, Marks: map[int]string{1: " ^^"}},
+			want: "|  | |  | |  |\n" +
+				"|GG| |RR| |  |\n" +
+				"|RR| |GG| |  |\n" +
+				"+--+ +--+ +--+\n" +
+				" 1    2    3\n" +
+				"      ^^\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Terminal(&buf, level, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("Terminal() differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTerminal_Color(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Terminal(&buf, level, TerminalOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := level.Palette.RGBA(watersort.Red)
+	want := "\x1b[38;2;" + fmt.Sprintf("%d;%d;%d", c.R, c.G, c.B) + "m██\x1b[0m"
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("Terminal() = %q, want it to contain %q", got, want)
+	}
+}
+
+func TestTerminal_Symbols(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Terminal(&buf, level, TerminalOptions{Symbols: true, Legend: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	c := level.Palette.RGBA(watersort.Red)
+	sym := level.Palette.Symbol(watersort.Red)
+	want := fmt.Sprintf("\x1b[48;2;%d;%d;%dm", c.R, c.G, c.B)
+	if !strings.Contains(got, want) {
+		t.Errorf("Terminal() = %q, want it to contain %q", got, want)
+	}
+	if want := sym + sym + "\x1b[0m " + level.Palette.Name(watersort.Red); !strings.Contains(got, want) {
+		t.Errorf("Terminal() = %q, want a legend entry %q", got, want)
+	}
+}
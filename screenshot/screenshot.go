@@ -0,0 +1,456 @@
+// Package screenshot builds a watersort.State from a screenshot of the game.
+//
+// The importer assumes a plain background with bottles drawn as outlines.
+// It finds the bottles as large, upright connected regions that differ from
+// the background, samples one color band per slot, clusters the samples and
+// maps each cluster to the closest color of the palette.
+package screenshot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/octo/watersort"
+)
+
+// Options control how a screenshot is interpreted.
+type Options struct {
+	// BottleSize is the number of slots in each bottle. Defaults to 4.
+	BottleSize int
+	// Palette holds the colors that may appear in the level.
+	// Defaults to watersort.DefaultPalette.
+	Palette watersort.Palette
+	// HeadSpace is the fraction of a bottle's inner height above the highest
+	// slot. Defaults to 0.1.
+	HeadSpace float64
+	// MinConfidence is the confidence below which a slot is reported as a
+	// Warning. Defaults to 0.6.
+	MinConfidence float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.BottleSize == 0 {
+		o.BottleSize = 4
+	}
+	if o.Palette == nil {
+		o.Palette = watersort.DefaultPalette
+	}
+	if o.HeadSpace == 0 {
+		o.HeadSpace = 0.1
+	}
+	if o.MinConfidence == 0 {
+		o.MinConfidence = 0.6
+	}
+	return o
+}
+
+// Result is the outcome of Import.
+type Result struct {
+	State watersort.State
+	// Bottles holds the bounding box of each bottle in the image.
+	Bottles []image.Rectangle
+	// Confidence holds a value in [0, 1] for every slot, indexed like State.
+	Confidence [][]float64
+	// Warnings lists slots whose confidence is below Options.MinConfidence.
+	Warnings []Warning
+}
+
+// Warning describes a slot the importer is unsure about.
+// Bottle and Slot are 0-based.
+type Warning struct {
+	Bottle, Slot int
+	Color        watersort.Color
+	Confidence   float64
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("bottle %d, slot %d: %v with low confidence (%.0f%%)",
+		w.Bottle+1, w.Slot+1, w.Color, 100*w.Confidence)
+}
+
+// ErrNoBottles is returned if no bottles were found in the image.
+var ErrNoBottles = errors.New("no bottles found")
+
+// Import finds the bottles in img and returns the corresponding state.
+//
+// If the resulting state is not valid, the Result is returned together with
+// the *watersort.ValidationError, so that callers can show what was detected.
+func Import(img image.Image, opts Options) (Result, error) {
+	opts = opts.withDefaults()
+
+	bg := background(img)
+	boxes := findBottles(img, bg)
+	if len(boxes) == 0 {
+		return Result{}, ErrNoBottles
+	}
+
+	var samples []sample
+	for i, box := range boxes {
+		for j, avg := range sampleBands(img, box, bg, opts) {
+			samples = append(samples, sample{
+				bottle: i,
+				slot:   j,
+				avg:    avg,
+			})
+		}
+	}
+
+	assignColors(samples, bg, opts.Palette)
+
+	res := Result{
+		State: watersort.State{
+			Bottles: make([]watersort.Bottle, len(boxes)),
+		},
+		Bottles:    boxes,
+		Confidence: make([][]float64, len(boxes)),
+	}
+	if !isDefaultPalette(opts.Palette) {
+		res.State.Palette = opts.Palette
+	}
+	for i := range res.State.Bottles {
+		res.State.Bottles[i].Colors = make([]watersort.Color, opts.BottleSize)
+		res.Confidence[i] = make([]float64, opts.BottleSize)
+	}
+	for _, s := range samples {
+		res.State.Bottles[s.bottle].Colors[s.slot] = s.color
+		res.Confidence[s.bottle][s.slot] = s.confidence
+		if s.confidence < opts.MinConfidence {
+			res.Warnings = append(res.Warnings, Warning{
+				Bottle:     s.bottle,
+				Slot:       s.slot,
+				Color:      s.color,
+				Confidence: s.confidence,
+			})
+		}
+	}
+
+	if err := res.State.Validate(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func isDefaultPalette(p watersort.Palette) bool {
+	if len(p) != len(watersort.DefaultPalette) {
+		return false
+	}
+	for i := range p {
+		if p[i] != watersort.DefaultPalette[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rgb is a color with float components in [0, 255].
+type rgb struct {
+	r, g, b float64
+}
+
+func toRGB(c color.Color) rgb {
+	r, g, b, _ := c.RGBA()
+	return rgb{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+}
+
+func (c rgb) dist(o rgb) float64 {
+	dr, dg, db := c.r-o.r, c.g-o.g, c.b-o.b
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+// maxDist is the largest possible distance between two colors.
+var maxDist = rgb{}.dist(rgb{255, 255, 255})
+
+// foregroundThreshold is the distance from the background above which a pixel
+// is considered to be part of a bottle.
+const foregroundThreshold = 40
+
+// background returns the most common color along the image border.
+func background(img image.Image) rgb {
+	b := img.Bounds()
+	counts := make(map[rgb]int)
+
+	add := func(x, y int) {
+		c := toRGB(img.At(x, y))
+		// Quantize to be robust against compression noise.
+		c = rgb{math.Round(c.r/8) * 8, math.Round(c.g/8) * 8, math.Round(c.b/8) * 8}
+		counts[c]++
+	}
+	for x := b.Min.X; x < b.Max.X; x++ {
+		add(x, b.Min.Y)
+		add(x, b.Max.Y-1)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		add(b.Min.X, y)
+		add(b.Max.X-1, y)
+	}
+
+	var (
+		ret  rgb
+		best int
+	)
+	for c, n := range counts {
+		if n > best || (n == best && c.r+c.g+c.b < ret.r+ret.g+ret.b) {
+			ret, best = c, n
+		}
+	}
+	return ret
+}
+
+// findBottles returns the bounding boxes of all bottles, ordered by row and
+// then from left to right.
+func findBottles(img image.Image, bg rgb) []image.Rectangle {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	fg := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fg[y*w+x] = toRGB(img.At(b.Min.X+x, b.Min.Y+y)).dist(bg) > foregroundThreshold
+		}
+	}
+
+	// Label connected components with a flood fill.
+	seen := make([]bool, w*h)
+	var (
+		boxes []image.Rectangle
+		stack []int
+	)
+	for start := range fg {
+		if !fg[start] || seen[start] {
+			continue
+		}
+
+		box := image.Rectangle{Min: image.Pt(w, h)}
+		seen[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			x, y := p%w, p/w
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[0] >= w || n[1] < 0 || n[1] >= h {
+					continue
+				}
+				if q := n[1]*w + n[0]; fg[q] && !seen[q] {
+					seen[q] = true
+					stack = append(stack, q)
+				}
+			}
+		}
+
+		if box.Dy() >= h/20 && box.Dy() > box.Dx() {
+			boxes = append(boxes, box.Add(b.Min))
+		}
+	}
+
+	sortBoxes(boxes)
+	return boxes
+}
+
+// sortBoxes sorts boxes into rows, top to bottom, and each row left to right.
+// Two boxes are in the same row if their vertical centers are within each other.
+func sortBoxes(boxes []image.Rectangle) {
+	sort.Slice(boxes, func(i, j int) bool {
+		return boxes[i].Min.Y < boxes[j].Min.Y
+	})
+
+	var rowStart int
+	for i := 1; i <= len(boxes); i++ {
+		if i < len(boxes) {
+			center := (boxes[i].Min.Y + boxes[i].Max.Y) / 2
+			if center < boxes[rowStart].Max.Y {
+				continue
+			}
+		}
+
+		row := boxes[rowStart:i]
+		sort.Slice(row, func(a, b int) bool {
+			return row[a].Min.X < row[b].Min.X
+		})
+		rowStart = i
+	}
+}
+
+// outlineWidth returns the thickness of the bottle's outline, measured from
+// the left edge at half height.
+func outlineWidth(img image.Image, box image.Rectangle, bg rgb) int {
+	y := (box.Min.Y + box.Max.Y) / 2
+	outline := toRGB(img.At(box.Min.X, y))
+
+	n := 0
+	for x := box.Min.X; x < box.Max.X; x++ {
+		c := toRGB(img.At(x, y))
+		if c.dist(outline) > foregroundThreshold || c.dist(bg) <= foregroundThreshold {
+			break
+		}
+		n++
+	}
+	if n == 0 || n > box.Dx()/4 {
+		return 1
+	}
+	return n
+}
+
+// sampleBands returns the average color of each slot, bottom to top.
+func sampleBands(img image.Image, box image.Rectangle, bg rgb, opts Options) []rgb {
+	t := outlineWidth(img, box, bg)
+	inner := image.Rect(box.Min.X+t, box.Min.Y+t, box.Max.X-t, box.Max.Y-t)
+
+	liquidTop := float64(inner.Min.Y) + opts.HeadSpace*float64(inner.Dy())
+	bandHeight := (float64(inner.Max.Y) - liquidTop) / float64(opts.BottleSize)
+
+	// Sample the center of each band to stay clear of edges and anti-aliasing.
+	x0 := inner.Min.X + inner.Dx()/4
+	x1 := inner.Max.X - inner.Dx()/4
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+
+	ret := make([]rgb, opts.BottleSize)
+	for i := range ret {
+		bottom := float64(inner.Max.Y) - float64(i)*bandHeight
+		y0 := int(bottom - 0.75*bandHeight)
+		y1 := int(bottom - 0.25*bandHeight)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		var (
+			sum rgb
+			n   float64
+		)
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				c := toRGB(img.At(x, y))
+				sum.r += c.r
+				sum.g += c.g
+				sum.b += c.b
+				n++
+			}
+		}
+		ret[i] = rgb{sum.r / n, sum.g / n, sum.b / n}
+	}
+
+	return ret
+}
+
+type sample struct {
+	bottle, slot int
+	avg          rgb
+
+	color      watersort.Color
+	confidence float64
+}
+
+// clusterThreshold is the distance below which two samples are considered the same color.
+const clusterThreshold = 30
+
+type cluster struct {
+	center  rgb
+	samples []*sample
+}
+
+// assignColors clusters the samples and maps each cluster to a distinct
+// palette color. Samples close to the background are Empty.
+func assignColors(samples []sample, bg rgb, p watersort.Palette) {
+	var clusters []*cluster
+	for i := range samples {
+		s := &samples[i]
+
+		if d := s.avg.dist(bg); d <= foregroundThreshold {
+			s.color = watersort.Empty
+			s.confidence = 1 - d/foregroundThreshold/2
+			continue
+		}
+
+		var best *cluster
+		for _, c := range clusters {
+			if d := s.avg.dist(c.center); d <= clusterThreshold && (best == nil || d < s.avg.dist(best.center)) {
+				best = c
+			}
+		}
+		if best == nil {
+			best = &cluster{center: s.avg}
+			clusters = append(clusters, best)
+		}
+
+		best.samples = append(best.samples, s)
+		n := float64(len(best.samples))
+		best.center = rgb{
+			best.center.r + (s.avg.r-best.center.r)/n,
+			best.center.g + (s.avg.g-best.center.g)/n,
+			best.center.b + (s.avg.b-best.center.b)/n,
+		}
+	}
+
+	// Greedily assign the closest (cluster, color) pairs first.
+	type pair struct {
+		cluster *cluster
+		color   watersort.Color
+		dist    float64
+	}
+	var pairs []pair
+	for _, cl := range clusters {
+		for i := range p {
+			c := watersort.Color(i + 1)
+			pairs = append(pairs, pair{cl, c, cl.center.dist(toRGB(p.RGBA(c)))})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].dist < pairs[j].dist
+	})
+
+	assigned := make(map[*cluster]bool)
+	used := make(map[watersort.Color]bool)
+	for _, pr := range pairs {
+		if assigned[pr.cluster] || used[pr.color] {
+			continue
+		}
+		assigned[pr.cluster] = true
+		used[pr.color] = true
+
+		for _, s := range pr.cluster.samples {
+			s.color = pr.color
+			s.confidence = confidence(pr.dist, s.avg.dist(pr.cluster.center))
+		}
+	}
+
+	// Clusters left over when there are more clusters than palette colors.
+	for _, cl := range clusters {
+		if assigned[cl] {
+			continue
+		}
+		for _, s := range cl.samples {
+			s.color = nearest(s.avg, p)
+			s.confidence = 0
+		}
+	}
+}
+
+// confidence combines the distance of a cluster to its palette color and the
+// distance of a sample to its cluster's center into a value in [0, 1].
+func confidence(paletteDist, clusterDist float64) float64 {
+	c := (1 - paletteDist/(maxDist/4)) * (1 - clusterDist/clusterThreshold/2)
+	return math.Max(0, math.Min(1, c))
+}
+
+func nearest(c rgb, p watersort.Palette) watersort.Color {
+	var (
+		ret  watersort.Color
+		best = math.Inf(1)
+	)
+	for i := range p {
+		col := watersort.Color(i + 1)
+		if d := c.dist(toRGB(p.RGBA(col))); d < best {
+			ret, best = col, d
+		}
+	}
+	return ret
+}
@@ -0,0 +1,140 @@
+package screenshot
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+	"github.com/octo/watersort/render"
+)
+
+var level = watersort.State{
+	Bottles: []watersort.Bottle{
+		{Colors: []watersort.Color{watersort.Red, watersort.Green, watersort.Blue, watersort.Yellow}},
+		{Colors: []watersort.Color{watersort.Yellow, watersort.Red, watersort.Green, watersort.Blue}},
+		{Colors: []watersort.Color{watersort.Blue, watersort.Yellow, watersort.Red, watersort.Green}},
+		{Colors: []watersort.Color{watersort.Green, watersort.Blue, watersort.Yellow, watersort.Red}},
+		{Colors: []watersort.Color{watersort.Empty, watersort.Empty, watersort.Empty, watersort.Empty}},
+		{Colors: []watersort.Color{watersort.Empty, watersort.Empty, watersort.Empty, watersort.Empty}},
+	},
+}
+
+// drawLevel renders s with perRow bottles in each row.
+func drawLevel(s watersort.State, perRow int) *image.RGBA {
+	return render.Image(s, render.Options{PerRow: perRow})
+}
+
+func TestImport(t *testing.T) {
+	cases := []struct {
+		name   string
+		perRow int
+		encode func(*bytes.Buffer, image.Image) error
+	}{
+		{
+			name:   "PNG",
+			perRow: 6,
+			encode: func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) },
+		},
+		{
+			name:   "JPEG",
+			perRow: 6,
+			encode: func(w *bytes.Buffer, img image.Image) error {
+				return jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+			},
+		},
+		{
+			name:   "two rows",
+			perRow: 4,
+			encode: func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) },
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.encode(&buf, drawLevel(level, tc.perRow)); err != nil {
+				t.Fatal(err)
+			}
+
+			img, _, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := Import(img, Options{})
+			if err != nil {
+				t.Fatalf("Import(): %v", err)
+			}
+
+			if diff := cmp.Diff(level, res.State); diff != "" {
+				t.Errorf("Import() state differs (-want/+got):\n%s", diff)
+			}
+			if len(res.Warnings) != 0 {
+				t.Errorf("Import() warnings = %v, want none", res.Warnings)
+			}
+		})
+	}
+}
+
+func TestImport_CustomPalette(t *testing.T) {
+	palette := watersort.Palette{
+		{Name: "Teal", RGB: "#008080", Symbol: "T"},
+		{Name: "Rose", RGB: "#ff0080", Symbol: "S"},
+	}
+	want := watersort.State{
+		Bottles: []watersort.Bottle{
+			{Colors: []watersort.Color{1, 2, 1}},
+			{Colors: []watersort.Color{2, 1, 2}},
+			{Colors: []watersort.Color{watersort.Empty, watersort.Empty, watersort.Empty}},
+			{Colors: []watersort.Color{watersort.Empty, watersort.Empty, watersort.Empty}},
+		},
+		Palette: palette,
+	}
+
+	res, err := Import(drawLevel(want, 4), Options{BottleSize: 3, Palette: palette})
+	if err != nil {
+		t.Fatalf("Import(): %v", err)
+	}
+
+	if diff := cmp.Diff(want, res.State); diff != "" {
+		t.Errorf("Import() state differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestImport_LowConfidence(t *testing.T) {
+	img := drawLevel(level, 6)
+
+	// Paint the bottom slot of the first bottle in a color that is not part of the palette.
+	box := image.Rect(33, img.Bounds().Max.Y-63, 73, img.Bounds().Max.Y-33)
+	draw.Draw(img, box, &image.Uniform{color.RGBA{0x80, 0x40, 0x90, 0xff}}, image.Point{}, draw.Src)
+
+	res, err := Import(img, Options{})
+	var verr *watersort.ValidationError
+	if err != nil && !errors.As(err, &verr) {
+		t.Fatalf("Import(): %v", err)
+	}
+
+	found := false
+	for _, w := range res.Warnings {
+		if w.Bottle == 0 && w.Slot == 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Import() warnings = %v, want a warning for bottle 1, slot 1", res.Warnings)
+	}
+}
+
+func TestImport_NoBottles(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	if _, err := Import(img, Options{}); !errors.Is(err, ErrNoBottles) {
+		t.Errorf("Import() = %v, want %v", err, ErrNoBottles)
+	}
+}
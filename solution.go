@@ -2,16 +2,19 @@ package watersort
 
 import (
 	"container/heap"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 )
 
 type solution struct {
 	State State
 	Steps []Step
 	Score int
+	// ExtraBottles is the number of empty bottles that may still be added.
+	ExtraBottles int
 }
 
 // Clone returns a deep copy of s.
@@ -24,6 +27,8 @@ func (s solution) Clone() solution {
 		State: state,
 		Steps: steps,
 		Score: s.Score,
+
+		ExtraBottles: s.ExtraBottles,
 	}
 }
 
@@ -36,15 +41,24 @@ func (s solution) Clone() solution {
 // Then it iterates over each bottle, determines its top color, and finds
 // possible destination for this color using the precomputed map.
 //
+// Locked bottles, bottles that do not allow pouring out, and destinations that
+// only accept a different color are skipped.
+//
 // Precomputing possible destinations per color reduces the bottle selection complexity from O(n²) to O(n)
 // (where n is the number of bottles/colors), assuming that Bottle.TopColor() is O(1).
 // (Bottle.TopColor() needs to skip empty spaces, of which there are (usually) 2× m, where m is the bottle size.
 // Assuming a linear relationship between n and m, armortized runtime of Bottle.TopColor() is constant.
 // Usually n > m.)
 func (s solution) PossibleSteps() []Step {
+	done := s.State.DoneBottles()
+	locked := make([]bool, len(s.State.Bottles))
+	for i, b := range s.State.Bottles {
+		locked[i] = b.LockedUntil > done
+	}
+
 	destinationsByColor := make(map[Color][]int)
 	for i, b := range s.State.Bottles {
-		if b.FreeSlots() == 0 {
+		if b.FreeSlots() == 0 || locked[i] {
 			continue
 		}
 		tc := b.TopColor()
@@ -54,7 +68,7 @@ func (s solution) PossibleSteps() []Step {
 	var ret []Step
 	for srcIndex, src := range s.State.Bottles {
 		tc := src.TopColor()
-		if tc == Empty {
+		if tc == Empty || src.NoPourOut || locked[srcIndex] {
 			continue
 		}
 
@@ -62,6 +76,9 @@ func (s solution) PossibleSteps() []Step {
 			if srcIndex == dstIndex {
 				continue
 			}
+			if ac := s.State.Bottles[dstIndex].AcceptOnly; ac != Empty && ac != tc {
+				continue
+			}
 
 			ret = append(ret, Step{
 				From:  srcIndex,
@@ -71,23 +88,107 @@ func (s solution) PossibleSteps() []Step {
 		}
 	}
 
-	rand.Shuffle(len(ret), func(i, j int) {
-		ret[i], ret[j] = ret[j], ret[i]
-	})
+	if s.ExtraBottles > 0 {
+		ret = append(ret, Step{Type: AddBottle})
+	}
 
 	return ret
 }
 
+// StepType distinguishes regular pours from power-ups.
+type StepType int
+
+const (
+	// Pour pours the top color of bottle "From" onto bottle "To".
+	Pour StepType = iota
+	// AddBottle adds an extra empty bottle. From and To are ignored.
+	AddBottle
+)
+
 // Step represents one state change, i.e. the pouring from bottle "From" to bottle "To".
 type Step struct {
 	From, To int
 	Color
+	Type StepType
 }
 
 func (s Step) String() string {
+	if s.Type == AddBottle {
+		return "add an empty bottle"
+	}
 	return fmt.Sprintf("pour %2d onto %2d (%v)", s.From+1, s.To+1, s.Color)
 }
 
+// stepJSON is the JSON representation of a step. Bottles are numbered from 1,
+// like in Step.String. Amount is only used by SolutionFile.
+type stepJSON struct {
+	Type   string `json:"type,omitempty"`
+	From   int    `json:"from,omitempty"`
+	To     int    `json:"to,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+const addBottleJSON = "add_bottle"
+
+func (s Step) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.toJSON(nil))
+}
+
+// toJSON converts s to its JSON representation, using the color names of p.
+func (s Step) toJSON(p Palette) stepJSON {
+	if s.Type == AddBottle {
+		return stepJSON{Type: addBottleJSON}
+	}
+
+	sj := stepJSON{
+		From: s.From + 1,
+		To:   s.To + 1,
+	}
+	if s.Color != Empty {
+		sj.Color = p.Name(s.Color)
+	}
+	return sj
+}
+
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var sj stepJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return err
+	}
+	return s.fromJSON(sj, nil)
+}
+
+// fromJSON sets s from its JSON representation, looking up color names in p.
+func (s *Step) fromJSON(sj stepJSON, p Palette) error {
+	switch sj.Type {
+	case "":
+	case addBottleJSON:
+		*s = Step{Type: AddBottle}
+		return nil
+	default:
+		return fmt.Errorf("unknown step type %q", sj.Type)
+	}
+
+	if sj.From < 1 || sj.To < 1 {
+		return fmt.Errorf("invalid step %d → %d: bottles are numbered from 1", sj.From, sj.To)
+	}
+
+	*s = Step{
+		From: sj.From - 1,
+		To:   sj.To - 1,
+	}
+	if sj.Color != "" {
+		c, err := p.ColorByName(sj.Color)
+		if err != nil {
+			return err
+		}
+		s.Color = c
+	}
+
+	return nil
+}
+
 type minHeap struct {
 	Solutions []solution
 }
@@ -125,10 +226,19 @@ func (h *minHeap) Pop() any {
 
 var ErrNoSolution = errors.New("there is no solution")
 
+// ErrStateLimit is returned when the solver gives up after evaluating the
+// number of states set with MaxStates.
+var ErrStateLimit = errors.New("the state limit was reached")
+
 type Option func(*option)
 
 type option struct {
 	reportComplexity *int
+	extraBottles     int
+	winCondition     WinCondition
+	ctx              context.Context
+	maxStates        int
+	progress         func(Progress)
 }
 
 func ReportComplexity(out *int) Option {
@@ -137,35 +247,141 @@ func ReportComplexity(out *int) Option {
 	}
 }
 
+// AllowExtraBottle lets the solver use the "extra bottle" power-up once.
+// Adding the bottle counts as a step, so it is only used when it leads to a
+// shorter solution or when the level cannot be solved without it.
+func AllowExtraBottle() Option {
+	return func(opt *option) {
+		opt.extraBottles = 1
+	}
+}
+
+// UseWinCondition makes the solver search for a state satisfying wc instead
+// of DefaultWinCondition.
+func UseWinCondition(wc WinCondition) Option {
+	return func(opt *option) {
+		opt.winCondition = wc
+	}
+}
+
+// WithContext stops the solver when ctx is done. Solve then returns an error
+// wrapping ctx.Err().
+func WithContext(ctx context.Context) Option {
+	return func(opt *option) {
+		opt.ctx = ctx
+	}
+}
+
+// MaxStates stops the solver after evaluating n states. Solve then returns an
+// error wrapping ErrStateLimit.
+func MaxStates(n int) Option {
+	return func(opt *option) {
+		opt.maxStates = n
+	}
+}
+
+// Progress describes a running search, see ReportProgress.
+type Progress struct {
+	// Expanded is the number of partial solutions whose steps were tried.
+	Expanded int
+	// StatesEvaluated is the number of distinct states seen so far.
+	StatesEvaluated int
+	// Frontier is the number of partial solutions waiting to be expanded.
+	Frontier int
+	// Score is the highest score expanded so far. Partial solutions are
+	// expanded in the order of their score, so it approaches the length of the
+	// solution from below.
+	Score int
+}
+
+// progressInterval is the number of expanded partial solutions between calls
+// to the ReportProgress callback.
+const progressInterval = 1000
+
+// ReportProgress calls fn regularly while the solver is running. fn is called
+// from the solver's goroutine and should return quickly.
+func ReportProgress(fn func(Progress)) Option {
+	return func(opt *option) {
+		opt.progress = fn
+	}
+}
+
 // Solve calculates an optimal solution for s using an A* search algorithm.
 //
 // The score of each (partial) solution is calculated as the sum of the number
-// of steps so far (len(Solution.Steps)) and Solution.State.MinRequiredMoves().
+// of steps so far (len(Solution.Steps)) and the win condition's
+// MinRequiredMoves().
+//
+// Steps of type AddBottle mark where the extra bottle is added,
+// see AllowExtraBottle.
+//
+// The search is deterministic: the same state and options always yield the
+// same solution.
 //
 // If s is unsolvable, an error is returned.
 // Use `errors.Is(ErrNoSolution)` to distinguish between this and other errors.
 func (s State) Solve(opts ...Option) ([]Step, error) {
-	sol := solution{
-		State: s,
+	opt := option{
+		winCondition: DefaultWinCondition,
 	}
-
-	var opt option
 	for _, f := range opts {
 		f(&opt)
 	}
 
+	sol := solution{
+		State:        s,
+		ExtraBottles: opt.extraBottles,
+	}
+
 	// h holds partial solutions.
 	// Pop() returns (one of) the solution closest to a solved state.
 	h := &minHeap{}
 	heap.Init(h)
 	heap.Push(h, sol)
 
-	// seen holds the CRC32 checksum of previously seen states to avoid cycles.
-	seen := make(map[uint32]bool)
+	// seen holds the fewest steps each state, identified by its CRC32
+	// checksum, was reached with. expanded holds the states whose steps were
+	// tried. A state is only expanded once, when it is reached with the fewest
+	// steps, so that the first solved state popped from h is optimal.
+	seen := map[uint32]int{s.checksum(): 0}
+	expanded := make(map[uint32]bool)
 
+	var progress Progress
 	for len(h.Solutions) > 0 {
+		if opt.ctx != nil && opt.ctx.Err() != nil {
+			return nil, fmt.Errorf("evaluated %d states: %w", len(seen), opt.ctx.Err())
+		}
+		if opt.maxStates > 0 && len(seen) >= opt.maxStates {
+			return nil, fmt.Errorf("evaluated %d states: %w", len(seen), ErrStateLimit)
+		}
+
 		base := heap.Pop(h).(solution)
 
+		chk := base.State.checksum()
+		if expanded[chk] {
+			continue
+		}
+		expanded[chk] = true
+
+		if opt.winCondition.Won(base.State) {
+			if opt.reportComplexity != nil {
+				*opt.reportComplexity = len(seen)
+			}
+			return base.Steps, nil
+		}
+
+		if opt.progress != nil {
+			progress.Expanded++
+			if base.Score > progress.Score {
+				progress.Score = base.Score
+			}
+			if progress.Expanded%progressInterval == 0 {
+				progress.StatesEvaluated = len(seen)
+				progress.Frontier = len(h.Solutions)
+				opt.progress(progress)
+			}
+		}
+
 		for _, step := range base.PossibleSteps() {
 			next := base.Clone()
 
@@ -175,23 +391,17 @@ func (s State) Solve(opts ...Option) ([]Step, error) {
 			}
 
 			chk := next.State.checksum()
-			if seen[chk] {
+			if n, ok := seen[chk]; ok && n <= len(next.Steps)+1 {
 				continue
 			}
 
 			next.Steps = append(next.Steps, step)
-
-			minRequiredMoves := next.State.minRequiredMoves()
-			next.Score = len(next.Steps) + minRequiredMoves
-			// log.Printf("Distance: %2d + %2d = %2d", len(next.Steps), minRequiredMoves, next.Distance)
-			if minRequiredMoves == 0 {
-				if opt.reportComplexity != nil {
-					*opt.reportComplexity = len(seen)
-				}
-				return next.Steps, nil
+			if step.Type == AddBottle {
+				next.ExtraBottles--
 			}
+			next.Score = len(next.Steps) + opt.winCondition.MinRequiredMoves(next.State)
 
-			seen[chk] = true
+			seen[chk] = len(next.Steps)
 			heap.Push(h, next)
 		}
 	}
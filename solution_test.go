@@ -1,7 +1,12 @@
 package watersort
 
 import (
+	"context"
+	"errors"
+	"math/rand"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 // level105 is "Water Sort Puzzle"'s infamous 105th level.
@@ -72,6 +77,74 @@ func TestFindSolution(t *testing.T) {
 	}
 }
 
+func TestSolve_ExtraBottle(t *testing.T) {
+	in := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+		},
+	}
+
+	if _, err := in.Solve(); !errors.Is(err, ErrNoSolution) {
+		t.Errorf("Solve() = %v, want %v", err, ErrNoSolution)
+	}
+
+	steps, err := in.Solve(AllowExtraBottle())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(steps), 4; got != want {
+		t.Errorf("solution has %d steps, want %d", got, want)
+	}
+	if len(steps) > 0 && steps[0].Type != AddBottle {
+		t.Errorf("steps[0] = %v, want the extra bottle to be added first", steps[0])
+	}
+}
+
+func TestSolve_WinCondition(t *testing.T) {
+	in := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Empty, Empty}},
+			{Colors: []Color{Empty, Empty}},
+		},
+	}
+
+	cases := []struct {
+		wc   WinCondition
+		want int
+	}{
+		{Sorted, 3},
+		{SingleColorBottles, 2},
+		{FullBottles, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.wc.String(), func(t *testing.T) {
+			steps, err := in.Solve(UseWinCondition(tc.wc))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(steps); got != tc.want {
+				t.Errorf("solution has %d steps, want %d", got, tc.want)
+			}
+
+			s := in.Clone()
+			for _, step := range steps {
+				if err := s.Apply(step); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tc.wc.Won(s) {
+				t.Errorf("%v.Won() = false after applying the solution", tc.wc)
+			}
+		})
+	}
+}
+
 func BenchmarkFindSolution(b *testing.B) {
 	if err := level105.sanityCheck(); err != nil {
 		b.Fatal(err)
@@ -88,3 +161,109 @@ func BenchmarkFindSolution(b *testing.B) {
 		}
 	}
 }
+
+func TestSolve_Limits(t *testing.T) {
+	if _, err := level105.Solve(MaxStates(100)); !errors.Is(err, ErrStateLimit) {
+		t.Errorf("Solve(MaxStates(100)) = %v, want %v", err, ErrStateLimit)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := level105.Solve(WithContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Solve(WithContext(canceled)) = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSolve_ReportProgress(t *testing.T) {
+	var reports []Progress
+	steps, err := level105.Solve(ReportProgress(func(p Progress) {
+		reports = append(reports, p)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) == 0 {
+		t.Fatal("ReportProgress() callback was not called")
+	}
+	for i, p := range reports {
+		if p.Expanded != (i+1)*progressInterval {
+			t.Errorf("reports[%d].Expanded = %d, want %d", i, p.Expanded, (i+1)*progressInterval)
+		}
+		if p.Score > len(steps) {
+			t.Errorf("reports[%d].Score = %d, want at most the solution length %d", i, p.Score, len(steps))
+		}
+	}
+}
+
+// shortestSolution returns the length of the shortest solution of s using a
+// breadth-first search.
+func shortestSolution(s State) int {
+	queue := []solution{{State: s}}
+	seen := map[uint32]bool{s.checksum(): true}
+	for len(queue) > 0 {
+		base := queue[0]
+		queue = queue[1:]
+		if base.State.Solved() {
+			return len(base.Steps)
+		}
+
+		for _, step := range base.PossibleSteps() {
+			next := base.Clone()
+			if err := next.State.Apply(step); err != nil {
+				continue
+			}
+			if chk := next.State.checksum(); !seen[chk] {
+				seen[chk] = true
+				next.Steps = append(next.Steps, step)
+				queue = append(queue, next)
+			}
+		}
+	}
+	return -1
+}
+
+func TestSolve_Optimal(t *testing.T) {
+	for seed := int64(0); seed < 30; seed++ {
+		s := GenerateState(rand.New(rand.NewSource(seed)), 4, 3, 1)
+
+		want := shortestSolution(s)
+		got, err := s.Solve()
+		if want == -1 {
+			if !errors.Is(err, ErrNoSolution) {
+				t.Errorf("seed %d: Solve() = %v, want %v", seed, err, ErrNoSolution)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("seed %d: Solve() = %v", seed, err)
+		}
+		if len(got) != want {
+			t.Errorf("seed %d: Solve() returned %d steps, want %d", seed, len(got), want)
+		}
+	}
+}
+
+func TestSolve_Deterministic(t *testing.T) {
+	s := GenerateState(rand.New(rand.NewSource(14)), 10, 4, 2)
+
+	var wantStates int
+	want, err := s.Solve(ReportComplexity(&wantStates))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		var gotStates int
+		got, err := s.Solve(ReportComplexity(&gotStates))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Solve() differs between runs (-want/+got):\n%s", diff)
+		}
+		if gotStates != wantStates {
+			t.Errorf("Solve() evaluated %d states, want %d", gotStates, wantStates)
+		}
+	}
+}
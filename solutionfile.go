@@ -0,0 +1,256 @@
+package watersort
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SolutionFormatVersion is the version of the solution file format written by WriteSolution.
+const SolutionFormatVersion = 1
+
+// CostSteps is the cost model used by Solve: every step, including adding an
+// extra bottle, costs one.
+const CostSteps = "steps"
+
+// SolutionFile is a solution together with the state it solves, stored as JSON:
+//
+//	{
+//	  "version": 1,
+//	  "state": [["Red", "Green"], …],
+//	  "win_condition": "sorted",
+//	  "cost_model": "steps",
+//	  "steps": [{"from": 1, "to": 3, "color": "Green", "amount": 1}, …],
+//	  "stats": {"states_evaluated": 12, "duration_ms": 3}
+//	}
+//
+// Bottles are numbered from 1, like in Step.String.
+type SolutionFile struct {
+	Version      int
+	State        State
+	WinCondition WinCondition
+	CostModel    string
+	Steps        []SolutionStep
+	Stats        SolverStats
+}
+
+// SolutionStep is a step together with the number of slots it pours.
+type SolutionStep struct {
+	Step
+	Amount int
+}
+
+// SolverStats describes the effort it took to find a solution.
+type SolverStats struct {
+	StatesEvaluated int
+	Duration        time.Duration
+}
+
+// NewSolutionFile replays steps on s to determine the color and amount of each
+// step and returns the resulting solution file.
+func NewSolutionFile(s State, steps []Step, stats SolverStats) (SolutionFile, error) {
+	f := SolutionFile{
+		Version:      SolutionFormatVersion,
+		State:        s.Clone(),
+		WinCondition: DefaultWinCondition,
+		CostModel:    CostSteps,
+		Stats:        stats,
+	}
+
+	s = s.Clone()
+	for i, step := range steps {
+		ss, err := applyRecorded(&s, step)
+		if err != nil {
+			return SolutionFile{}, fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(step), err)
+		}
+		f.Steps = append(f.Steps, ss)
+	}
+
+	return f, nil
+}
+
+// applyRecorded applies step to s and returns the step with its color and amount.
+func applyRecorded(s *State, step Step) (SolutionStep, error) {
+	if step.Type == AddBottle {
+		if err := s.Apply(step); err != nil {
+			return SolutionStep{}, err
+		}
+		return SolutionStep{Step: Step{Type: AddBottle}}, nil
+	}
+
+	if step.From < 0 || step.From >= len(s.Bottles) || step.To < 0 || step.To >= len(s.Bottles) {
+		return SolutionStep{}, fmt.Errorf("there are %d bottles", len(s.Bottles))
+	}
+
+	step.Color = s.Bottles[step.From].TopColor()
+	before := s.Bottles[step.To].FreeSlots()
+	if err := s.Apply(step); err != nil {
+		return SolutionStep{}, err
+	}
+
+	return SolutionStep{
+		Step:   step,
+		Amount: before - s.Bottles[step.To].FreeSlots(),
+	}, nil
+}
+
+// PlainSteps returns the steps without amounts.
+func (f SolutionFile) PlainSteps() []Step {
+	ret := make([]Step, len(f.Steps))
+	for i, ss := range f.Steps {
+		ret[i] = ss.Step
+	}
+	return ret
+}
+
+// Verify replays the solution. It returns an error if the state is not valid,
+// if a step cannot be applied, if more than one extra bottle is added, if a
+// step's color or amount does not match the recorded one, or if the final state
+// does not satisfy the win condition.
+func (f SolutionFile) Verify() error {
+	if err := f.State.Validate(); err != nil {
+		return err
+	}
+
+	wc := f.WinCondition
+	if wc == nil {
+		wc = DefaultWinCondition
+	}
+
+	s := f.State.Clone()
+	extraBottles := defaultExtraBottles
+	for i, want := range f.Steps {
+		if want.Type == AddBottle {
+			if extraBottles <= 0 {
+				return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(want.Step), ErrNoExtraBottle)
+			}
+			extraBottles--
+		}
+		got, err := applyRecorded(&s, want.Step)
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(want.Step), err)
+		}
+		if want.Color != Empty && got.Color != want.Color {
+			return fmt.Errorf("step %d: poured %s, want %s", i+1, s.Palette.Name(got.Color), s.Palette.Name(want.Color))
+		}
+		if want.Amount != 0 && got.Amount != want.Amount {
+			return fmt.Errorf("step %d: poured %d slots, want %d", i+1, got.Amount, want.Amount)
+		}
+	}
+
+	if !wc.Won(s) {
+		return fmt.Errorf("state does not satisfy win condition %q after %d steps", wc, len(f.Steps))
+	}
+	return nil
+}
+
+type solutionFileJSON struct {
+	Version      int              `json:"version"`
+	State        State            `json:"state"`
+	WinCondition string           `json:"win_condition,omitempty"`
+	CostModel    string           `json:"cost_model,omitempty"`
+	Steps        []stepJSON       `json:"steps"`
+	Stats        *solverStatsJSON `json:"stats,omitempty"`
+}
+
+type solverStatsJSON struct {
+	StatesEvaluated int   `json:"states_evaluated,omitempty"`
+	DurationMS      int64 `json:"duration_ms,omitempty"`
+}
+
+func (f SolutionFile) MarshalJSON() ([]byte, error) {
+	fj := solutionFileJSON{
+		Version:   f.Version,
+		State:     f.State,
+		CostModel: f.CostModel,
+		Steps:     []stepJSON{},
+	}
+	if f.WinCondition != nil {
+		fj.WinCondition = f.WinCondition.String()
+	}
+	if f.Stats != (SolverStats{}) {
+		fj.Stats = &solverStatsJSON{
+			StatesEvaluated: f.Stats.StatesEvaluated,
+			DurationMS:      f.Stats.Duration.Milliseconds(),
+		}
+	}
+
+	for _, ss := range f.Steps {
+		sj := ss.Step.toJSON(f.State.Palette)
+		sj.Amount = ss.Amount
+		fj.Steps = append(fj.Steps, sj)
+	}
+
+	return json.Marshal(fj)
+}
+
+func (f *SolutionFile) UnmarshalJSON(data []byte) error {
+	var fj solutionFileJSON
+	if err := json.Unmarshal(data, &fj); err != nil {
+		return err
+	}
+
+	*f = SolutionFile{
+		Version:   fj.Version,
+		State:     fj.State,
+		CostModel: fj.CostModel,
+	}
+	if fj.WinCondition != "" {
+		wc, err := WinConditionByName(fj.WinCondition)
+		if err != nil {
+			return err
+		}
+		f.WinCondition = wc
+	}
+	if fj.Stats != nil {
+		f.Stats = SolverStats{
+			StatesEvaluated: fj.Stats.StatesEvaluated,
+			Duration:        time.Duration(fj.Stats.DurationMS) * time.Millisecond,
+		}
+	}
+
+	for _, sj := range fj.Steps {
+		ss := SolutionStep{Amount: sj.Amount}
+		if err := ss.Step.fromJSON(sj, fj.State.Palette); err != nil {
+			return err
+		}
+		f.Steps = append(f.Steps, ss)
+	}
+
+	return nil
+}
+
+// WriteSolution writes f to w as indented JSON.
+// If f.Version is zero, SolutionFormatVersion is used.
+func WriteSolution(w io.Writer, f SolutionFile) error {
+	if f.Version == 0 {
+		f.Version = SolutionFormatVersion
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadSolution reads a solution file from r. Use SolutionFile.Verify to check
+// that the solution is correct.
+func ReadSolution(r io.Reader) (SolutionFile, error) {
+	var f SolutionFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return SolutionFile{}, err
+	}
+
+	if f.Version < 1 || f.Version > SolutionFormatVersion {
+		return SolutionFile{}, fmt.Errorf("unsupported solution format version %d", f.Version)
+	}
+	if f.CostModel != "" && f.CostModel != CostSteps {
+		return SolutionFile{}, fmt.Errorf("unsupported cost model %q", f.CostModel)
+	}
+
+	return f, nil
+}
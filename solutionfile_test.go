@@ -0,0 +1,110 @@
+package watersort
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSolutionFile(t *testing.T) {
+	in := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green, Green}},
+			{Colors: []Color{Green, Red, Red}},
+			{Colors: []Color{Empty, Empty, Empty}},
+			{Colors: []Color{Empty, Empty, Empty}},
+		},
+	}
+
+	steps, err := in.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewSolutionFile(in, steps, SolverStats{StatesEvaluated: 3, Duration: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Verify(); err != nil {
+		t.Fatalf("Verify(): %v", err)
+	}
+
+	var b strings.Builder
+	if err := WriteSolution(&b, f); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadSolution(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, got); diff != "" {
+		t.Errorf("solution file differs (-want/+got):\n%s", diff)
+	}
+	if diff := cmp.Diff(steps, got.PlainSteps()); diff != "" {
+		t.Errorf("steps differ (-want/+got):\n%s", diff)
+	}
+
+	got.Steps[0].Amount++
+	if err := got.Verify(); err == nil {
+		t.Error("Verify() succeeded for a tampered amount, want error")
+	}
+
+	got.Steps[0].Amount--
+	got.Steps = got.Steps[:len(got.Steps)-1]
+	if err := got.Verify(); err == nil {
+		t.Error("Verify() succeeded for an incomplete solution, want error")
+	}
+}
+
+func TestSolutionFile_ExtraBottles(t *testing.T) {
+	in := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Empty, Empty}},
+		},
+	}
+	add := Step{Type: AddBottle}
+	solution := []Step{{From: 0, To: 2}, {From: 1, To: 0}, {From: 1, To: 2}}
+
+	f, err := NewSolutionFile(in, append([]Step{add}, solution...), SolverStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Verify(); err != nil {
+		t.Errorf("Verify() with one extra bottle = %v, want nil", err)
+	}
+
+	f.Steps = append([]SolutionStep{{Step: add}}, f.Steps...)
+	if err := f.Verify(); !errors.Is(err, ErrNoExtraBottle) {
+		t.Errorf("Verify() with two extra bottles = %v, want %v", err, ErrNoExtraBottle)
+	}
+}
+
+func TestSolutionFile_InvalidState(t *testing.T) {
+	for _, in := range []string{
+		`{"version": 1, "state": [], "steps": [{"type": "add_bottle"}]}`,
+		`{"version": 1, "state": [[]], "steps": [{"type": "add_bottle"}]}`,
+		`{"version": 1, "state": [["Red", "Empty"], ["Empty", "Empty"]], "steps": []}`,
+	} {
+		f, err := ReadSolution(strings.NewReader(in))
+		if err != nil {
+			continue
+		}
+		var verr *ValidationError
+		if err := f.Verify(); !errors.As(err, &verr) {
+			t.Errorf("Verify() of %s = %v, want a *ValidationError", in, err)
+		}
+	}
+}
+
+func TestReadSolution_Version(t *testing.T) {
+	in := `{"version": 2, "state": [["Empty"]], "steps": []}`
+	if _, err := ReadSolution(strings.NewReader(in)); err == nil {
+		t.Error("ReadSolution() succeeded, want error")
+	}
+}
@@ -1,20 +1,40 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/octo/watersort"
+	"github.com/octo/watersort/render"
 )
 
 var (
 	input            = flag.String("input", "", "file to read from")
+	code             = flag.String("code", "", "level code to solve instead of reading a file")
+	printCode        = flag.Bool("print_code", false, "print the level code of the input level")
 	reportComplexity = flag.Bool("report_complexity", false, "print how many states were considered to find the solution")
+	extraBottle      = flag.Bool("extra_bottle", false, "allow the solver to add one extra empty bottle")
+	winCondition     = flag.String("win_condition", watersort.DefaultWinCondition.String(),
+		"when the level is solved; one of \"sorted\", \"single_color_bottles\", \"full_bottles\"")
+	format = flag.String("format", "text", "output format; \"text\" prints one step per line, \"json\" prints a solution file")
+	verify = flag.String("verify", "", "solution file to check instead of solving a level")
+
+	renderDir    = flag.String("render_dir", "", "directory to write one image per step of the solution to")
+	renderFormat = flag.String("render_format", "png", "image format used with -render_dir; \"png\" or \"svg\"")
+	board        = flag.String("board", "none", "when to draw the bottles; \"none\", \"steps\" after every step, or \"ends\" at the start and end")
+	boardStyle   = flag.String("board_style", "color", "how to draw the bottles; \"color\" uses true-color ANSI escapes, \"ascii\" palette symbols")
+	gifPath      = flag.String("gif", "", "file to write an animated GIF of the solution to")
+	gifDelay     = flag.Duration("gif_delay", render.DefaultDelay, "time each step is shown in the animated GIF")
+	symbols      = flag.Bool("symbols", false, "draw the palette symbol of each color onto the water in boards and images")
+	legend       = flag.Bool("legend", false, "list the symbol and name of each color below boards and images")
+	themeName    = flag.String("theme", render.DefaultTheme.String(), "colors of images; \"default\" or \"high-contrast\"")
 )
 
 func main() {
@@ -22,30 +42,253 @@ func main() {
 
 	rand.Seed(time.Now().UnixMicro())
 
-	var in io.Reader = os.Stdin
-	if *input != "" {
-		f, err := os.Open(*input)
+	if *verify != "" {
+		if err := verifySolution(*verify); err != nil {
+			log.Fatalf("%s: %v", *verify, err)
+		}
+		fmt.Println("Solution is valid.")
+		return
+	}
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("invalid -format %q", *format)
+	}
+	if *renderFormat != "png" && *renderFormat != "svg" {
+		log.Fatalf("invalid -render_format %q", *renderFormat)
+	}
+	if *board != "none" && *board != "steps" && *board != "ends" {
+		log.Fatalf("invalid -board %q", *board)
+	}
+	if *boardStyle != "color" && *boardStyle != "ascii" {
+		log.Fatalf("invalid -board_style %q", *boardStyle)
+	}
+
+	theme, err := render.ParseTheme(*themeName)
+	if err != nil {
+		log.Fatalf("invalid -theme: %v", err)
+	}
+
+	level, err := loadLevel()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *printCode {
+		c, err := watersort.EncodeCode(level)
 		if err != nil {
-			log.Fatalf("Open(%q): %v", *input, err)
+			log.Fatalln("watersort.EncodeCode():", err)
 		}
-		in = f
+		fmt.Println("Level code:", c)
 	}
 
-	level, err := watersort.LoadLevel(in)
+	wc, err := watersort.WinConditionByName(*winCondition)
 	if err != nil {
-		log.Fatalln("watersort.LoadLevel():", err)
+		log.Fatal(err)
 	}
 
 	var complexity int
-	steps, err := level.Solve(watersort.ReportComplexity(&complexity))
+	opts := []watersort.Option{
+		watersort.ReportComplexity(&complexity),
+		watersort.UseWinCondition(wc),
+	}
+	if *extraBottle {
+		opts = append(opts, watersort.AllowExtraBottle())
+	}
+
+	start := time.Now()
+	steps, err := level.Solve(opts...)
 	if err != nil {
 		log.Fatalln("watersort.FindSolution():", err)
 	}
 
+	if *renderDir != "" {
+		if err := renderSteps(*renderDir, level, steps, theme); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *gifPath != "" {
+		if err := writeGIF(*gifPath, level, steps, theme); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *format == "json" {
+		f, err := watersort.NewSolutionFile(level, steps, watersort.SolverStats{
+			StatesEvaluated: complexity,
+			Duration:        time.Since(start),
+		})
+		if err != nil {
+			log.Fatalln("watersort.NewSolutionFile():", err)
+		}
+		f.WinCondition = wc
+
+		if err := watersort.WriteSolution(os.Stdout, f); err != nil {
+			log.Fatalln("watersort.WriteSolution():", err)
+		}
+		return
+	}
+
+	if *board != "none" {
+		printBoard(level)
+	}
+
+	usesExtraBottle := false
+	s := level.Clone()
 	for i, step := range steps {
-		fmt.Printf("Step %2d: %v\n", i+1, step)
+		fmt.Printf("Step %2d: %s\n", i+1, level.Palette.FormatStep(step))
+		if step.Type == watersort.AddBottle {
+			usesExtraBottle = true
+		}
+
+		if *board == "none" {
+			continue
+		}
+		if err := s.Apply(step); err != nil {
+			log.Fatalf("step %d (%s): %v", i+1, level.Palette.FormatStep(step), err)
+		}
+		if *board == "steps" || i == len(steps)-1 {
+			printBoard(s)
+		}
+	}
+	if usesExtraBottle {
+		if _, err := level.Solve(watersort.UseWinCondition(wc)); errors.Is(err, watersort.ErrNoSolution) {
+			fmt.Println("The level cannot be solved without the extra bottle.")
+		} else if err == nil {
+			fmt.Println("The level can also be solved without the extra bottle.")
+		}
 	}
 	if *reportComplexity {
 		fmt.Printf("Complexity: %d\n", complexity)
 	}
 }
+
+func printBoard(s watersort.State) {
+	fmt.Println()
+	opts := render.TerminalOptions{
+		ASCII:   *boardStyle == "ascii",
+		Symbols: *symbols,
+		Legend:  *legend,
+	}
+	if err := render.Terminal(os.Stdout, s, opts); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println()
+}
+
+// renderSteps writes one image per step to dir: step-000 shows the initial
+// state with an arrow for the first step, the last image shows the solved state.
+func renderSteps(dir string, level watersort.State, steps []watersort.Step, theme render.Theme) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	s := level.Clone()
+	for i := 0; i <= len(steps); i++ {
+		opts := render.Options{
+			Symbols: *symbols,
+			Legend:  *legend,
+			Theme:   theme,
+		}
+		if i < len(steps) {
+			opts.Step = &steps[i]
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("step-%03d.%s", i, *renderFormat))
+		if err := writeImage(path, s, opts); err != nil {
+			return err
+		}
+
+		if i < len(steps) {
+			if err := s.Apply(steps[i]); err != nil {
+				return fmt.Errorf("step %d (%s): %w", i+1, s.Palette.FormatStep(steps[i]), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeImage(path string, s watersort.State, opts render.Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if *renderFormat == "svg" {
+		err = render.SVG(f, s, opts)
+	} else {
+		err = render.PNG(f, s, opts)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f.Close()
+}
+
+func writeGIF(path string, level watersort.State, steps []watersort.Step, theme render.Theme) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = render.GIF(f, level, steps, render.GIFOptions{
+		Delay:     *gifDelay,
+		Highlight: true,
+		Captions:  true,
+		Symbols:   *symbols,
+		Legend:    *legend,
+		Theme:     theme,
+	})
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f.Close()
+}
+
+func verifySolution(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sf, err := watersort.ReadSolution(f)
+	if err != nil {
+		return err
+	}
+
+	return sf.Verify()
+}
+
+func loadLevel() (watersort.State, error) {
+	if *code != "" {
+		level, err := watersort.DecodeCode(*code)
+		if err != nil {
+			return watersort.State{}, err
+		}
+		if err := level.Validate(); err != nil {
+			return watersort.State{}, err
+		}
+		return level, nil
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return watersort.State{}, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	level, err := watersort.LoadLevel(in)
+	if err != nil {
+		return watersort.State{}, fmt.Errorf("watersort.LoadLevel(): %w", err)
+	}
+	return level, nil
+}
@@ -3,24 +3,44 @@ package watersort
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type State struct {
 	Bottles []Bottle
+
+	// Palette defines the colors of the level. If nil, DefaultPalette is used.
+	Palette Palette
 }
 
+// LoadLevel reads a level from r and validates it. The level may be encoded
+// as JSON or in the compact text format, see TextLevel.
 func LoadLevel(r io.Reader) (State, error) {
-	var s State
-	if err := json.NewDecoder(r).Decode(&s); err != nil {
+	data, err := io.ReadAll(r)
+	if err != nil {
 		return State{}, err
 	}
 
+	var s State
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return State{}, err
+		}
+	} else {
+		l, err := ParseText(bytes.NewReader(data))
+		if err != nil {
+			return State{}, err
+		}
+		s = l.State
+	}
+
 	if err := s.sanityCheck(); err != nil {
 		return State{}, err
 	}
@@ -28,7 +48,20 @@ func LoadLevel(r io.Reader) (State, error) {
 	return s, nil
 }
 
+// RandomState returns a random level with colorsNum colors, bottles of
+// bottleSize slots and two empty bottles.
 func RandomState(colorsNum, bottleSize int) State {
+	return randomState(rand.Shuffle, colorsNum, bottleSize, 2)
+}
+
+// GenerateState is like RandomState, but uses rng as the source of randomness
+// and adds emptyBottles empty bottles. The same seed and arguments always
+// result in the same level.
+func GenerateState(rng *rand.Rand, colorsNum, bottleSize, emptyBottles int) State {
+	return randomState(rng.Shuffle, colorsNum, bottleSize, emptyBottles)
+}
+
+func randomState(shuffle func(n int, swap func(i, j int)), colorsNum, bottleSize, emptyBottles int) State {
 	colors := make([]Color, colorsNum*bottleSize)
 	for i := 0; i < colorsNum; i++ {
 		for j := 0; j < bottleSize; j++ {
@@ -36,7 +69,7 @@ func RandomState(colorsNum, bottleSize int) State {
 		}
 	}
 
-	rand.Shuffle(len(colors), func(i, j int) {
+	shuffle(len(colors), func(i, j int) {
 		colors[i], colors[j] = colors[j], colors[i]
 	})
 
@@ -55,7 +88,9 @@ func RandomState(colorsNum, bottleSize int) State {
 	for j := 0; j < bottleSize; j++ {
 		empty.Colors = append(empty.Colors, Empty)
 	}
-	s.Bottles = append(s.Bottles, empty.Clone(), empty.Clone())
+	for i := 0; i < emptyBottles; i++ {
+		s.Bottles = append(s.Bottles, empty.Clone())
+	}
 
 	return s
 }
@@ -67,46 +102,229 @@ func (s State) Clone() State {
 	}
 	return State{
 		Bottles: bottles,
+		Palette: s.Palette,
 	}
 }
 
+// Validate checks that s is a well-formed level. If it is not, the returned
+// error is a *ValidationError listing every problem found.
+func (s State) Validate() error {
+	return s.sanityCheck()
+}
+
 func (s State) sanityCheck() error {
-	var bottleSize int
+	var issues []Issue
+
+	for i, e := range s.Palette {
+		if _, err := parseRGB(e.RGB); e.RGB != "" && err != nil {
+			issues = append(issues, Issue{
+				Kind:   InvalidRGB,
+				Bottle: -1,
+				Slot:   -1,
+				Color:  Color(i + 1),
+			})
+		}
+	}
+
+	if len(s.Bottles) == 0 {
+		issues = append(issues, Issue{
+			Kind:   NoBottles,
+			Bottle: -1,
+			Slot:   -1,
+		})
+		return &ValidationError{Issues: issues, Palette: s.Palette}
+	}
+
+	bottleSize := len(s.Bottles[0].Colors)
+	if bottleSize == 0 {
+		issues = append(issues, Issue{
+			Kind:   NoSlots,
+			Bottle: -1,
+			Slot:   -1,
+		})
+		return &ValidationError{Issues: issues, Palette: s.Palette}
+	}
 	colorCounts := make(map[Color]int)
 
 	for i, b := range s.Bottles {
-		if bottleSize == 0 {
-			bottleSize = len(b.Colors)
-		}
 		if len(b.Colors) != bottleSize {
-			return fmt.Errorf("not all bottles have the same size: bottle %d has %d colors, want %d",
-				i+1, len(b.Colors), bottleSize)
+			issues = append(issues, Issue{
+				Kind:   BottleSizeMismatch,
+				Bottle: i,
+				Slot:   -1,
+				Got:    len(b.Colors),
+				Want:   bottleSize,
+			})
 		}
-		for i, c := range b.Colors {
+		for j, c := range b.Colors {
 			colorCounts[c] = colorCounts[c] + 1
-			if i != 0 && c != Empty && b.Colors[i-1] == Empty {
-				return fmt.Errorf("bottle %d: cannot stack color on top of empty", i+1)
+			if j != 0 && c != Empty && b.Colors[j-1] == Empty {
+				issues = append(issues, Issue{
+					Kind:   StackedOnEmpty,
+					Bottle: i,
+					Slot:   j,
+					Color:  c,
+				})
+			}
+			if b.AcceptOnly != Empty && c != Empty && c != b.AcceptOnly {
+				issues = append(issues, Issue{
+					Kind:   ForeignColor,
+					Bottle: i,
+					Slot:   j,
+					Color:  c,
+				})
 			}
 		}
 	}
 
-	if colorCounts[Empty] != 2*bottleSize {
-		return fmt.Errorf("got %d empty slots, want %d", colorCounts[Empty], 2*bottleSize)
+	// Each color can complete one bottle, so locks waiting for more bottles
+	// never open.
+	doneable := len(colorCounts)
+	if colorCounts[Empty] != 0 {
+		doneable--
+	}
+	for i, b := range s.Bottles {
+		if b.LockedUntil < 0 || b.LockedUntil > doneable {
+			issues = append(issues, Issue{
+				Kind:   InvalidLock,
+				Bottle: i,
+				Slot:   -1,
+				Got:    b.LockedUntil,
+				Want:   doneable,
+			})
+		}
+		if b.AcceptOnly != Empty && colorCounts[b.AcceptOnly] == 0 {
+			issues = append(issues, Issue{
+				Kind:   UnknownAcceptOnly,
+				Bottle: i,
+				Slot:   -1,
+				Color:  b.AcceptOnly,
+			})
+		}
 	}
-	for c, n := range colorCounts {
+
+	// The empty slots must fill at least one bottle, and a whole number of bottles.
+	if n := colorCounts[Empty]; n < bottleSize || n%bottleSize != 0 {
+		want := (n + bottleSize - 1) / bottleSize * bottleSize
+		if want < bottleSize {
+			want = bottleSize
+		}
+		issues = append(issues, Issue{
+			Kind:   ColorCountMismatch,
+			Bottle: -1,
+			Slot:   -1,
+			Color:  Empty,
+			Got:    n,
+			Want:   want,
+		})
+	}
+
+	var colors []Color
+	for c := range colorCounts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		return colors[i] < colors[j]
+	})
+
+	for _, c := range colors {
 		if c == Empty {
 			continue
 		}
-		if n != bottleSize {
-			return fmt.Errorf("color %v: got %d slots, want %d", c, n, bottleSize)
+		if n := colorCounts[c]; n != bottleSize {
+			issues = append(issues, Issue{
+				Kind:   ColorCountMismatch,
+				Bottle: -1,
+				Slot:   -1,
+				Color:  c,
+				Got:    n,
+				Want:   bottleSize,
+			})
 		}
 	}
 
+	if len(issues) != 0 {
+		return &ValidationError{Issues: issues, Palette: s.Palette}
+	}
 	return nil
 }
 
 func (s *State) Apply(step Step) error {
-	return s.Bottles[step.From].PourOnto(&s.Bottles[step.To])
+	if step.Type == AddBottle {
+		if len(s.Bottles) == 0 {
+			return errors.New("cannot add a bottle to a level without bottles")
+		}
+		s.Bottles = append(s.Bottles, Bottle{
+			Colors: make([]Color, s.BottleSize()),
+		})
+		return nil
+	}
+
+	if step.From < 0 || step.From >= len(s.Bottles) || step.To < 0 || step.To >= len(s.Bottles) {
+		return fmt.Errorf("invalid step %d → %d: there are %d bottles", step.From+1, step.To+1, len(s.Bottles))
+	}
+
+	if s.Locked(step.From) {
+		return fmt.Errorf("bottle %d is locked", step.From+1)
+	}
+	if s.Locked(step.To) {
+		return fmt.Errorf("bottle %d is locked", step.To+1)
+	}
+
+	if err := s.Bottles[step.From].PourOnto(&s.Bottles[step.To]); err != nil {
+		return err
+	}
+
+	s.unlock()
+	return nil
+}
+
+// DoneBottles returns the number of bottles that are filled with a single color.
+func (s State) DoneBottles() int {
+	ret := 0
+	for _, b := range s.Bottles {
+		if b.Done() {
+			ret++
+		}
+	}
+	return ret
+}
+
+// Colors returns the colors used in s in ascending order, without Empty.
+func (s State) Colors() []Color {
+	used := make(map[Color]bool)
+	for _, b := range s.Bottles {
+		for _, c := range b.Colors {
+			if c != Empty {
+				used[c] = true
+			}
+		}
+	}
+
+	ret := make([]Color, 0, len(used))
+	for c := range used {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// Locked returns true if bottle i is locked, i.e. fewer than
+// Bottle.LockedUntil bottles are done.
+func (s State) Locked(i int) bool {
+	lu := s.Bottles[i].LockedUntil
+	return lu > 0 && s.DoneBottles() < lu
+}
+
+// unlock clears LockedUntil of all bottles whose condition is met.
+// Bottles stay unlocked, even if the number of done bottles drops again later.
+func (s *State) unlock() {
+	done := s.DoneBottles()
+	for i := range s.Bottles {
+		if s.Bottles[i].LockedUntil <= done {
+			s.Bottles[i].LockedUntil = 0
+		}
+	}
 }
 
 func (s State) minRequiredMoves() int {
@@ -131,8 +349,9 @@ func (s State) minRequiredMoves() int {
 	return ret
 }
 
+// Solved returns true if s satisfies DefaultWinCondition.
 func (s State) Solved() bool {
-	return s.minRequiredMoves() == 0
+	return DefaultWinCondition.Won(s)
 }
 
 func (s State) checksum() uint32 {
@@ -141,6 +360,9 @@ func (s State) checksum() uint32 {
 		for _, c := range b.Colors {
 			data = append(data, byte(c))
 		}
+		if b.LockedUntil > 0 {
+			data = append(data, 0xff, byte(b.LockedUntil))
+		}
 	}
 
 	return crc32.ChecksumIEEE(data)
@@ -150,12 +372,54 @@ func (s State) BottleSize() int {
 	return len(s.Bottles[0].Colors)
 }
 
+// stateJSON is the JSON representation of a state with its own palette.
+// States using the default palette are encoded as a plain list of bottles.
+type stateJSON struct {
+	Palette Palette           `json:"palette"`
+	Bottles []json.RawMessage `json:"bottles"`
+}
+
 func (s State) MarshalJSON() ([]byte, error) {
-	return json.Marshal(s.Bottles)
+	if s.Palette == nil {
+		return json.Marshal(s.Bottles)
+	}
+
+	sj := stateJSON{
+		Palette: s.Palette,
+	}
+	for _, b := range s.Bottles {
+		data, err := b.marshalJSON(s.Palette)
+		if err != nil {
+			return nil, err
+		}
+		sj.Bottles = append(sj.Bottles, data)
+	}
+
+	return json.Marshal(sj)
 }
 
 func (s *State) UnmarshalJSON(data []byte) error {
-	return json.Unmarshal(data, &s.Bottles)
+	var sj stateJSON
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		if err := json.Unmarshal(data, &sj.Bottles); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, &sj); err != nil {
+		return err
+	}
+
+	*s = State{
+		Palette: sj.Palette,
+	}
+	for _, data := range sj.Bottles {
+		var b Bottle
+		if err := b.unmarshalJSON(data, sj.Palette); err != nil {
+			return err
+		}
+		s.Bottles = append(s.Bottles, b)
+	}
+
+	return nil
 }
 
 func (s State) MarshalText() ([]byte, error) {
@@ -188,16 +452,36 @@ func (s *State) UnmarshalText(text []byte) error {
 
 type Bottle struct {
 	Colors []Color
+
+	// AcceptOnly, if not Empty, is the only color that may be poured into the bottle.
+	AcceptOnly Color
+	// LockedUntil is the number of bottles that need to be done before
+	// anything can be poured into or out of the bottle. Zero means unlocked.
+	LockedUntil int
+	// NoPourOut prevents pouring colors out of the bottle.
+	NoPourOut bool
 }
 
 func (b Bottle) Clone() Bottle {
 	colors := make([]Color, len(b.Colors))
 	copy(colors, b.Colors)
 	return Bottle{
-		Colors: colors,
+		Colors:      colors,
+		AcceptOnly:  b.AcceptOnly,
+		LockedUntil: b.LockedUntil,
+		NoPourOut:   b.NoPourOut,
 	}
 }
 
+func (b Bottle) hasConstraints() bool {
+	return b.AcceptOnly != Empty || b.LockedUntil != 0 || b.NoPourOut
+}
+
+// Done returns true if the bottle is full and holds a single color.
+func (b Bottle) Done() bool {
+	return len(b.Colors) != 0 && b.BottomColor() != Empty && b.TopColorCount() == len(b.Colors)
+}
+
 func (b Bottle) TopColor() Color {
 	for i := len(b.Colors) - 1; i >= 0; i-- {
 		if b.Colors[i] != Empty {
@@ -236,6 +520,10 @@ func (b Bottle) FreeSlots() int {
 }
 
 func (b *Bottle) PourOnto(other *Bottle) error {
+	if b.NoPourOut {
+		return fmt.Errorf("cannot pour out of this bottle")
+	}
+
 	c := b.TopColor()
 
 	n, err := other.add(c, b.TopColorCount())
@@ -263,6 +551,10 @@ func (b *Bottle) add(c Color, n int) (int, error) {
 		return 0, fmt.Errorf("no space available")
 	}
 
+	if b.AcceptOnly != Empty && b.AcceptOnly != c {
+		return 0, fmt.Errorf("cannot pour color %v into a bottle that only accepts %v", c, b.AcceptOnly)
+	}
+
 	if tc := b.TopColor(); tc != Empty && tc != c {
 		return 0, fmt.Errorf("cannot pour color %v onto %v", c, tc)
 	}
@@ -294,24 +586,114 @@ func (b *Bottle) MinRequiredMoves() int {
 	return ret
 }
 
+// bottleJSON is the JSON representation of a bottle with constraints.
+// Bottles without constraints are encoded as a plain list of color names.
+type bottleJSON struct {
+	Colors      []string `json:"colors"`
+	AcceptOnly  string   `json:"accept_only,omitempty"`
+	LockedUntil int      `json:"locked_until,omitempty"`
+	NoPourOut   bool     `json:"no_pour_out,omitempty"`
+}
+
 func (b Bottle) MarshalJSON() ([]byte, error) {
-	return json.Marshal(b.Colors)
+	return b.marshalJSON(nil)
+}
+
+// marshalJSON encodes b using the color names of p.
+func (b Bottle) marshalJSON(p Palette) ([]byte, error) {
+	names := make([]string, len(b.Colors))
+	for i, c := range b.Colors {
+		names[i] = p.Name(c)
+	}
+
+	if !b.hasConstraints() {
+		return json.Marshal(names)
+	}
+
+	bj := bottleJSON{
+		Colors:      names,
+		LockedUntil: b.LockedUntil,
+		NoPourOut:   b.NoPourOut,
+	}
+	if b.AcceptOnly != Empty {
+		bj.AcceptOnly = p.Name(b.AcceptOnly)
+	}
+	return json.Marshal(bj)
 }
 
 func (b *Bottle) UnmarshalJSON(data []byte) error {
-	return json.Unmarshal(data, &b.Colors)
+	return b.unmarshalJSON(data, nil)
 }
 
+// unmarshalJSON decodes b, looking up color names in p.
+func (b *Bottle) unmarshalJSON(data []byte, p Palette) error {
+	var bj bottleJSON
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		if err := json.Unmarshal(data, &bj.Colors); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, &bj); err != nil {
+		return err
+	}
+
+	*b = Bottle{
+		LockedUntil: bj.LockedUntil,
+		NoPourOut:   bj.NoPourOut,
+	}
+	for _, name := range bj.Colors {
+		c, err := p.ColorByName(name)
+		if err != nil {
+			return err
+		}
+		b.Colors = append(b.Colors, c)
+	}
+	if bj.AcceptOnly != "" {
+		c, err := p.ColorByName(bj.AcceptOnly)
+		if err != nil {
+			return err
+		}
+		b.AcceptOnly = c
+	}
+
+	return nil
+}
+
+// MarshalText encodes the bottle as dash-separated color numbers, e.g. "1-2-0-0".
+// Constraints are appended after a colon, e.g. "1-2-0-0:a3,l2,n" for
+// AcceptOnly=3, LockedUntil=2 and NoPourOut.
 func (b Bottle) MarshalText() ([]byte, error) {
 	var colors []string
 	for _, c := range b.Colors {
 		colors = append(colors, strconv.Itoa(int(c)))
 	}
-	return []byte(strings.Join(colors, "-")), nil
+	text := strings.Join(colors, "-")
+
+	var constraints []string
+	if b.AcceptOnly != Empty {
+		constraints = append(constraints, "a"+strconv.Itoa(int(b.AcceptOnly)))
+	}
+	if b.LockedUntil != 0 {
+		constraints = append(constraints, "l"+strconv.Itoa(b.LockedUntil))
+	}
+	if b.NoPourOut {
+		constraints = append(constraints, "n")
+	}
+	if len(constraints) != 0 {
+		text += ":" + strings.Join(constraints, ",")
+	}
+
+	return []byte(text), nil
 }
 
 func (b *Bottle) UnmarshalText(text []byte) error {
-	b.Colors = nil
+	*b = Bottle{}
+
+	if i := bytes.IndexByte(text, ':'); i >= 0 {
+		if err := b.unmarshalConstraints(text[i+1:]); err != nil {
+			return err
+		}
+		text = text[:i]
+	}
 
 	for _, c := range bytes.Split(text, []byte("-")) {
 		color, err := strconv.Atoi(string(c))
@@ -324,6 +706,38 @@ func (b *Bottle) UnmarshalText(text []byte) error {
 	return nil
 }
 
+func (b *Bottle) unmarshalConstraints(text []byte) error {
+	for _, c := range bytes.Split(text, []byte(",")) {
+		if len(c) == 0 {
+			return fmt.Errorf("empty bottle constraint")
+		}
+
+		switch c[0] {
+		case 'a':
+			n, err := strconv.Atoi(string(c[1:]))
+			if err != nil {
+				return fmt.Errorf("invalid bottle constraint %q: %w", c, err)
+			}
+			b.AcceptOnly = Color(n)
+		case 'l':
+			n, err := strconv.Atoi(string(c[1:]))
+			if err != nil {
+				return fmt.Errorf("invalid bottle constraint %q: %w", c, err)
+			}
+			b.LockedUntil = n
+		case 'n':
+			if len(c) != 1 {
+				return fmt.Errorf("invalid bottle constraint %q", c)
+			}
+			b.NoPourOut = true
+		default:
+			return fmt.Errorf("unknown bottle constraint %q", c)
+		}
+	}
+
+	return nil
+}
+
 type Color int
 
 const (
@@ -343,68 +757,25 @@ const (
 	Yellow
 )
 
-var nameByColor = map[Color]string{
-	Empty:      "Empty",
-	Blue:       "Blue",
-	Brown:      "Brown",
-	DarkBlue:   "DarkBlue",
-	DarkGreen:  "DarkGreen",
-	Gray:       "Gray",
-	Green:      "Green",
-	LightGreen: "LightGreen",
-	LightBlue:  "LightBlue",
-	Orange:     "Orange",
-	Pink:       "Pink",
-	Purple:     "Purple",
-	Red:        "Red",
-	Yellow:     "Yellow",
-}
-
 func (c Color) String() string {
-	if name, ok := nameByColor[c]; ok {
-		return name
-	}
-	return fmt.Sprintf("color#%d", c)
+	return DefaultPalette.Name(c)
 }
 
 func (c Color) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.String())
 }
 
-var colorByName = map[string]Color{
-	"Empty":      Empty,
-	"Blue":       Blue,
-	"Brown":      Brown,
-	"DarkBlue":   DarkBlue,
-	"DarkGreen":  DarkGreen,
-	"Gray":       Gray,
-	"Green":      Green,
-	"LightGreen": LightGreen,
-	"LightBlue":  LightBlue,
-	"Orange":     Orange,
-	"Pink":       Pink,
-	"Purple":     Purple,
-	"Red":        Red,
-	"Yellow":     Yellow,
-}
-
 func (c *Color) UnmarshalJSON(data []byte) error {
 	var name string
 	if err := json.Unmarshal(data, &name); err != nil {
 		return err
 	}
 
-	var ok bool
-	*c, ok = colorByName[name]
-	if ok {
-		return nil
-	}
-
-	i, err := strconv.Atoi(strings.TrimPrefix(name, "color#"))
+	color, err := DefaultPalette.ColorByName(name)
 	if err != nil {
-		return fmt.Errorf("%q is not a valid color: %w", name, err)
+		return err
 	}
 
-	*c = Color(i)
+	*c = color
 	return nil
 }
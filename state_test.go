@@ -1,6 +1,11 @@
 package watersort
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -197,3 +202,472 @@ func TestTestdata(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		in   State
+		want []Issue
+	}{
+		{
+			name: "valid",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red}},
+					{Colors: []Color{Empty, Empty}},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+		},
+		{
+			name: "locked until all colors are done",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red}},
+					{Colors: []Color{Empty, Empty}},
+					{Colors: []Color{Empty, Empty}, LockedUntil: 2},
+				},
+			},
+		},
+		{
+			name: "one empty bottle",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red}},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+		},
+		{
+			name: "three empty bottles",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red}},
+					{Colors: []Color{Empty, Empty}},
+					{Colors: []Color{Empty, Empty}},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+		},
+		{
+			name: "no empty bottle",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red}},
+				},
+			},
+			want: []Issue{
+				{Kind: ColorCountMismatch, Bottle: -1, Slot: -1, Color: Empty, Got: 0, Want: 2},
+			},
+		},
+		{
+			name: "no bottles",
+			in:   State{},
+			want: []Issue{
+				{Kind: NoBottles, Bottle: -1, Slot: -1},
+			},
+		},
+		{
+			name: "no slots",
+			in: State{
+				Bottles: []Bottle{{}, {}},
+			},
+			want: []Issue{
+				{Kind: NoSlots, Bottle: -1, Slot: -1},
+			},
+		},
+		{
+			name: "multiple issues",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Green, Red, Red}},
+					{Colors: []Color{Empty, Blue}},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+			want: []Issue{
+				{Kind: BottleSizeMismatch, Bottle: 1, Slot: -1, Got: 3, Want: 2},
+				{Kind: StackedOnEmpty, Bottle: 2, Slot: 1, Color: Blue},
+				{Kind: ColorCountMismatch, Bottle: -1, Slot: -1, Color: Empty, Got: 3, Want: 4},
+				{Kind: ColorCountMismatch, Bottle: -1, Slot: -1, Color: Blue, Got: 1, Want: 2},
+				{Kind: ColorCountMismatch, Bottle: -1, Slot: -1, Color: Red, Got: 3, Want: 2},
+			},
+		},
+		{
+			name: "constraints",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}, AcceptOnly: Red},
+					{Colors: []Color{Green, Red}, LockedUntil: 3},
+					{Colors: []Color{Empty, Empty}, AcceptOnly: Blue},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+			want: []Issue{
+				{Kind: ForeignColor, Bottle: 0, Slot: 1, Color: Green},
+				{Kind: InvalidLock, Bottle: 1, Slot: -1, Got: 3, Want: 2},
+				{Kind: UnknownAcceptOnly, Bottle: 2, Slot: -1, Color: Blue},
+			},
+		},
+		{
+			name: "invalid rgb",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{1, 2}},
+					{Colors: []Color{2, 1}},
+					{Colors: []Color{Empty, Empty}},
+				},
+				Palette: Palette{
+					{Name: "Teal", RGB: "#fff"},
+					{Name: "Rose", RGB: `red"/><script>`},
+					{Name: "Gold"},
+				},
+			},
+			want: []Issue{
+				{Kind: InvalidRGB, Bottle: -1, Slot: -1, Color: 1},
+				{Kind: InvalidRGB, Bottle: -1, Slot: -1, Color: 2},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.in.Validate()
+			if tc.want == nil {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+
+			if diff := cmp.Diff(tc.want, verr.Issues); diff != "" {
+				t.Errorf("issues differ (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateState(t *testing.T) {
+	a := GenerateState(rand.New(rand.NewSource(42)), 5, 4, 3)
+	b := GenerateState(rand.New(rand.NewSource(42)), 5, 4, 3)
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("GenerateState() with the same seed differs (-first, +second):\n%s", diff)
+	}
+
+	if got, want := len(a.Bottles), 8; got != want {
+		t.Errorf("len(Bottles) = %d, want %d", got, want)
+	}
+	if err := a.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestState_Colors(t *testing.T) {
+	s := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Blue}},
+			{Colors: []Color{Blue, Empty}},
+			{Colors: []Color{Empty, Empty}},
+		},
+	}
+	if diff := cmp.Diff([]Color{Blue, Red}, s.Colors()); diff != "" {
+		t.Errorf("Colors() differs (-want, +got):\n%s", diff)
+	}
+}
+
+func TestLoadLevel_ReportsAllIssues(t *testing.T) {
+	in := `[["Red", "Red"], ["Empty", "Green"], ["Empty", "Empty"]]`
+
+	_, err := LoadLevel(strings.NewReader(in))
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("LoadLevel() = %v, want a *ValidationError", err)
+	}
+	if got, want := len(verr.Issues), 3; got != want {
+		t.Errorf("LoadLevel() reported %d issues, want %d: %v", got, want, err)
+	}
+}
+
+func TestLoadLevel_NoSlots(t *testing.T) {
+	for _, in := range []string{`[[]]`, `[[], []]`} {
+		if _, err := LoadLevel(strings.NewReader(in)); err == nil {
+			t.Errorf("LoadLevel(%s) succeeded, want error", in)
+		}
+	}
+}
+
+func TestBottleConstraints(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      State
+		step    Step
+		wantErr bool
+	}{
+		{
+			name: "accept only matching color",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Empty, Empty}, AcceptOnly: Green},
+				},
+			},
+			step: Step{From: 0, To: 1},
+		},
+		{
+			name: "accept only other color",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Empty, Empty}, AcceptOnly: Red},
+				},
+			},
+			step:    Step{From: 0, To: 1},
+			wantErr: true,
+		},
+		{
+			name: "no pour out",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}, NoPourOut: true},
+					{Colors: []Color{Empty, Empty}},
+				},
+			},
+			step:    Step{From: 0, To: 1},
+			wantErr: true,
+		},
+		{
+			name: "locked destination",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+				},
+			},
+			step:    Step{From: 0, To: 1},
+			wantErr: true,
+		},
+		{
+			name: "unlocked destination",
+			in: State{
+				Bottles: []Bottle{
+					{Colors: []Color{Blue, Blue}},
+					{Colors: []Color{Red, Green}},
+					{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+				},
+			},
+			step: Step{From: 1, To: 2},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sol := solution{State: tc.in}
+			possible := false
+			for _, step := range sol.PossibleSteps() {
+				if step.From == tc.step.From && step.To == tc.step.To {
+					possible = true
+				}
+			}
+			if possible == tc.wantErr {
+				t.Errorf("PossibleSteps() includes %v = %v, want %v", tc.step, possible, !tc.wantErr)
+			}
+
+			err := tc.in.Apply(tc.step)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Apply(%v) = %v, want error %v", tc.step, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBottleConstraints_Unlock(t *testing.T) {
+	s := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Empty}},
+			{Colors: []Color{Green, Red}},
+			{Colors: []Color{Green, Empty}, LockedUntil: 1},
+		},
+	}
+
+	if !s.Locked(2) {
+		t.Fatal("Locked(2) = false, want true")
+	}
+	if err := s.Apply(Step{From: 1, To: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Locked(2) {
+		t.Fatal("Locked(2) = true after completing a bottle, want false")
+	}
+
+	// Taking the done bottle apart again does not re-lock bottle 3.
+	if err := s.Apply(Step{From: 2, To: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Locked(2) {
+		t.Error("Locked(2) = true, want false")
+	}
+}
+
+func TestBottleConstraints_Encoding(t *testing.T) {
+	want := State{
+		Bottles: []Bottle{
+			{Colors: []Color{Red, Green}},
+			{Colors: []Color{Green, Red}, NoPourOut: true},
+			{Colors: []Color{Empty, Empty}, AcceptOnly: Red},
+			{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+		},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := LoadLevel(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("LoadLevel(%s): %v", data, err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("state differs (-want/+got):\n%s", diff)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		text, err := want.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got State
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q): %v", text, err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("state differs (-want/+got):\n%s", diff)
+		}
+	})
+}
+
+func TestPalette_LevelFile(t *testing.T) {
+	in := `{
+		"palette": [
+			{"name": "Teal", "rgb": "#008080", "symbol": "T"},
+			{"name": "Rose", "rgb": "#ff0080", "symbol": "S"}
+		],
+		"bottles": [
+			["Teal", "Rose"],
+			["Rose", "Teal"],
+			{"colors": ["Empty", "Empty"], "accept_only": "Teal"},
+			["Empty", "Empty"]
+		]
+	}`
+
+	got, err := LoadLevel(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := State{
+		Bottles: []Bottle{
+			{Colors: []Color{1, 2}},
+			{Colors: []Color{2, 1}},
+			{Colors: []Color{Empty, Empty}, AcceptOnly: 1},
+			{Colors: []Color{Empty, Empty}},
+		},
+		Palette: Palette{
+			{Name: "Teal", RGB: "#008080", Symbol: "T"},
+			{Name: "Rose", RGB: "#ff0080", Symbol: "S"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("state differs (-want/+got):\n%s", diff)
+	}
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"Rose"`)) {
+		t.Errorf("json.Marshal() = %s, want colors named by the palette", data)
+	}
+
+	var roundTrip State
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, roundTrip); diff != "" {
+		t.Errorf("state differs after round trip (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPalette_InvalidRGB(t *testing.T) {
+	for _, rgb := range []string{"#fff", "red", "#00808g", "#+08080", `red"/><script>alert(1)</script>`} {
+		in := `{"palette": [{"name": "Teal", "rgb": "` + strings.ReplaceAll(rgb, `"`, `\"`) + `", "symbol": "T"}], "bottles": [["Teal"], ["Empty"]]}`
+
+		var s State
+		if err := json.Unmarshal([]byte(in), &s); err == nil {
+			t.Errorf("json.Unmarshal(%s) succeeded, want error", in)
+		}
+	}
+
+	p := Palette{{Name: "Teal", RGB: "#00808F"}}
+	if got, want := p.RGBA(1), (color.RGBA{R: 0x00, G: 0x80, B: 0x8f, A: 0xff}); got != want {
+		t.Errorf("RGBA(1) = %v, want %v", got, want)
+	}
+}
+
+func TestPalette_Fallback(t *testing.T) {
+	var p Palette
+
+	if got, want := p.Name(Red), "Red"; got != want {
+		t.Errorf("Name(Red) = %q, want %q", got, want)
+	}
+	if got, want := p.Name(Color(17)), "color#17"; got != want {
+		t.Errorf("Name(17) = %q, want %q", got, want)
+	}
+	if got := p.RGB(Color(17)); len(got) != 7 || got[0] != '#' {
+		t.Errorf("RGB(17) = %q, want a CSS hex color", got)
+	}
+	if got, err := p.ColorByName("color#17"); err != nil || got != Color(17) {
+		t.Errorf("ColorByName(%q) = (%v, %v), want (%v, nil)", "color#17", got, err, Color(17))
+	}
+}
+
+func TestPalette_MarshalStep(t *testing.T) {
+	p := Palette{
+		{Name: "Teal", RGB: "#008080"},
+		{Name: "Rose", RGB: "#ff0080"},
+	}
+	step := Step{From: 0, To: 2, Color: 2}
+
+	data, err := p.MarshalStep(step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"from":1,"to":3,"color":"Rose"}`; got != want {
+		t.Errorf("MarshalStep() = %s, want %s", got, want)
+	}
+
+	got, err := p.UnmarshalStep(data)
+	if err != nil {
+		t.Fatalf("UnmarshalStep(): %v", err)
+	}
+	if diff := cmp.Diff(step, got); diff != "" {
+		t.Errorf("step differs after round trip (-want/+got):\n%s", diff)
+	}
+}
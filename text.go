@@ -0,0 +1,324 @@
+package watersort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextLevel is a level in the compact, line based text format:
+//
+//	# Lines starting with "#" are comments.
+//	@name Level 105
+//	@color T Teal #008080
+//	BBED
+//	T.. accept=T
+//	....
+//
+// Header lines start with "@" and must precede the bottles. "@color" lines
+// define a custom palette: the symbol, the name and optionally the RGB value in
+// "#rrggbb" notation, in the order of the colors. The symbol is a single
+// character other than white space, ".", "#" and "@". All other header lines
+// are kept in Header.
+//
+// Each remaining line is one bottle, one symbol per slot from bottom to top.
+// "." is an empty slot. Bottle constraints follow the colors, separated by
+// white space: "accept=<symbol>", "locked=<n>" and "no-pour-out". A "#" after
+// the colors starts a comment.
+type TextLevel struct {
+	State  State
+	Header map[string]string
+}
+
+// SyntaxError is returned by ParseText for malformed input.
+// Line and Column are 1-based.
+type SyntaxError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseText parses a level in the compact text format.
+// The returned state is not validated, see State.Validate.
+func ParseText(r io.Reader) (TextLevel, error) {
+	p := textParser{
+		level: TextLevel{
+			Header: make(map[string]string),
+		},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.line++
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return TextLevel{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return TextLevel{}, err
+	}
+
+	if len(p.level.State.Bottles) == 0 {
+		return TextLevel{}, &SyntaxError{Line: p.line + 1, Column: 1, Msg: "no bottles found"}
+	}
+
+	return p.level, nil
+}
+
+// reservedSymbols start comment and header lines and cannot be color symbols.
+const reservedSymbols = "#@"
+
+type textParser struct {
+	level      TextLevel
+	line       int
+	seenBottle bool
+}
+
+func (p *textParser) errorf(col int, format string, args ...any) error {
+	return &SyntaxError{
+		Line:   p.line,
+		Column: col,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// fields splits line at white space and returns the fields together with
+// their 1-based (rune) column.
+func fields(line string) ([]string, []int) {
+	var (
+		ret  []string
+		cols []int
+		col  = 1
+		cur  strings.Builder
+		from int
+	)
+
+	for _, r := range line {
+		if unicode.IsSpace(r) {
+			if cur.Len() != 0 {
+				ret = append(ret, cur.String())
+				cols = append(cols, from)
+				cur.Reset()
+			}
+		} else {
+			if cur.Len() == 0 {
+				from = col
+			}
+			cur.WriteRune(r)
+		}
+		col++
+	}
+	if cur.Len() != 0 {
+		ret = append(ret, cur.String())
+		cols = append(cols, from)
+	}
+
+	return ret, cols
+}
+
+func (p *textParser) parseLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil
+	}
+
+	fs, cols := fields(line)
+	if strings.HasPrefix(fs[0], "@") {
+		if p.seenBottle {
+			return p.errorf(cols[0], "header line after the first bottle")
+		}
+		return p.parseHeader(fs, cols)
+	}
+
+	// Comments may follow the bottle.
+	for i := 1; i < len(fs); i++ {
+		if strings.HasPrefix(fs[i], "#") {
+			fs, cols = fs[:i], cols[:i]
+			break
+		}
+	}
+
+	p.seenBottle = true
+	return p.parseBottle(fs, cols)
+}
+
+func (p *textParser) parseHeader(fs []string, cols []int) error {
+	key := strings.TrimPrefix(fs[0], "@")
+	if key == "" {
+		return p.errorf(cols[0], "missing header key")
+	}
+
+	if key != "color" {
+		var value string
+		if len(fs) > 1 {
+			value = strings.Join(fs[1:], " ")
+		}
+		p.level.Header[key] = value
+		return nil
+	}
+
+	if len(fs) < 3 || len(fs) > 4 {
+		return p.errorf(cols[0], "want \"@color <symbol> <name> [<rgb>]\"")
+	}
+	if utf8.RuneCountInString(fs[1]) != 1 {
+		return p.errorf(cols[1], "symbol %q is not a single character", fs[1])
+	}
+	if fs[1] == emptySymbol {
+		return p.errorf(cols[1], "symbol %q is reserved for empty slots", fs[1])
+	}
+	if strings.Contains(reservedSymbols, fs[1]) {
+		return p.errorf(cols[1], "symbol %q is reserved for comments and header lines", fs[1])
+	}
+	for _, e := range p.level.State.Palette {
+		if e.Symbol == fs[1] {
+			return p.errorf(cols[1], "duplicate symbol %q", fs[1])
+		}
+		if e.Name == fs[2] {
+			return p.errorf(cols[2], "duplicate color name %q", fs[2])
+		}
+	}
+
+	e := PaletteEntry{
+		Symbol: fs[1],
+		Name:   fs[2],
+	}
+	if len(fs) == 4 {
+		if _, err := parseRGB(fs[3]); err != nil {
+			return p.errorf(cols[3], "%v", err)
+		}
+		e.RGB = fs[3]
+	}
+	p.level.State.Palette = append(p.level.State.Palette, e)
+
+	return nil
+}
+
+func (p *textParser) parseBottle(fs []string, cols []int) error {
+	palette := p.level.State.Palette
+
+	var b Bottle
+	col := cols[0]
+	for _, r := range fs[0] {
+		c, err := palette.ColorBySymbol(string(r))
+		if err != nil {
+			return p.errorf(col, "unknown color symbol %q", r)
+		}
+		b.Colors = append(b.Colors, c)
+		col++
+	}
+
+	for i := 1; i < len(fs); i++ {
+		name, value, hasValue := strings.Cut(fs[i], "=")
+
+		switch name {
+		case "accept":
+			c, err := palette.ColorBySymbol(value)
+			if !hasValue || err != nil || c == Empty {
+				return p.errorf(cols[i], "want \"accept=<symbol>\"")
+			}
+			b.AcceptOnly = c
+		case "locked":
+			n, err := strconv.Atoi(value)
+			if !hasValue || err != nil {
+				return p.errorf(cols[i], "want \"locked=<number>\"")
+			}
+			b.LockedUntil = n
+		case "no-pour-out":
+			if hasValue {
+				return p.errorf(cols[i], "\"no-pour-out\" does not take a value")
+			}
+			b.NoPourOut = true
+		default:
+			return p.errorf(cols[i], "unknown bottle constraint %q", fs[i])
+		}
+	}
+
+	p.level.State.Bottles = append(p.level.State.Bottles, b)
+	return nil
+}
+
+// textSymbol reports whether sym can be a color symbol in the text format.
+func textSymbol(sym string) bool {
+	r, size := utf8.DecodeRuneInString(sym)
+	return size == len(sym) && r != utf8.RuneError && !unicode.IsSpace(r) &&
+		sym != emptySymbol && !strings.Contains(reservedSymbols, sym)
+}
+
+// WriteText writes l in the compact text format.
+func WriteText(w io.Writer, l TextLevel) error {
+	var keys []string
+	for k := range l.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "" || k == "color" || strings.ContainsAny(k, " \t\n") || strings.Contains(l.Header[k], "\n") {
+			return fmt.Errorf("header %q cannot be encoded", k)
+		}
+		if _, err := fmt.Fprintf(w, "@%s %s\n", k, l.Header[k]); err != nil {
+			return err
+		}
+	}
+
+	palette := l.State.Palette
+	for _, e := range palette {
+		if strings.ContainsAny(e.Name, " \t\n") || strings.ContainsAny(e.RGB, " \t\n") || !textSymbol(e.Symbol) {
+			return fmt.Errorf("color %q cannot be encoded", e.Name)
+		}
+		line := fmt.Sprintf("@color %s %s", e.Symbol, e.Name)
+		if e.RGB != "" {
+			line += " " + e.RGB
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	symbol := func(c Color) (string, error) {
+		sym := palette.Symbol(c)
+		if got, err := palette.ColorBySymbol(sym); err != nil || got != c {
+			return "", fmt.Errorf("color %s has no unique symbol", palette.Name(c))
+		}
+		return sym, nil
+	}
+
+	for _, b := range l.State.Bottles {
+		var line strings.Builder
+		for _, c := range b.Colors {
+			sym, err := symbol(c)
+			if err != nil {
+				return err
+			}
+			line.WriteString(sym)
+		}
+
+		if b.AcceptOnly != Empty {
+			sym, err := symbol(b.AcceptOnly)
+			if err != nil {
+				return err
+			}
+			line.WriteString(" accept=" + sym)
+		}
+		if b.LockedUntil != 0 {
+			line.WriteString(" locked=" + strconv.Itoa(b.LockedUntil))
+		}
+		if b.NoPourOut {
+			line.WriteString(" no-pour-out")
+		}
+
+		if _, err := fmt.Fprintln(w, line.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package watersort
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseText(t *testing.T) {
+	in := `# A small level.
+@name Tiny
+@author octo
+
+RG   # bottle comment
+GR no-pour-out
+.. accept=R
+.. locked=1
+`
+
+	got, err := ParseText(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := TextLevel{
+		State: State{
+			Bottles: []Bottle{
+				{Colors: []Color{Red, Green}},
+				{Colors: []Color{Green, Red}, NoPourOut: true},
+				{Colors: []Color{Empty, Empty}, AcceptOnly: Red},
+				{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+			},
+		},
+		Header: map[string]string{
+			"name":   "Tiny",
+			"author": "octo",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseText() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestParseText_Errors(t *testing.T) {
+	cases := []struct {
+		name       string
+		in         string
+		wantLine   int
+		wantColumn int
+	}{
+		{
+			name:       "unknown symbol",
+			in:         "RG\nGX\n",
+			wantLine:   2,
+			wantColumn: 2,
+		},
+		{
+			name:       "header after bottle",
+			in:         "RG\n  @name late\n",
+			wantLine:   2,
+			wantColumn: 3,
+		},
+		{
+			name:       "bad constraint",
+			in:         "# comment\nRG locked=x\n",
+			wantLine:   2,
+			wantColumn: 4,
+		},
+		{
+			name:       "duplicate symbol",
+			in:         "@color T Teal\n@color T Tan\n",
+			wantLine:   2,
+			wantColumn: 8,
+		},
+		{
+			name:       "comment symbol",
+			in:         "@color # Teal\n@color R Red\n##..\nRR..\n....\n",
+			wantLine:   1,
+			wantColumn: 8,
+		},
+		{
+			name:       "header symbol",
+			in:         "@color @ Teal\n",
+			wantLine:   1,
+			wantColumn: 8,
+		},
+		{
+			name:       "empty symbol",
+			in:         "@color . Teal\n",
+			wantLine:   1,
+			wantColumn: 8,
+		},
+		{
+			name:       "bad rgb",
+			in:         "@color T Teal #fff\n",
+			wantLine:   1,
+			wantColumn: 15,
+		},
+		{
+			name:       "no bottles",
+			in:         "@name empty\n",
+			wantLine:   2,
+			wantColumn: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseText(strings.NewReader(tc.in))
+
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("ParseText() = %v, want a *SyntaxError", err)
+			}
+			if serr.Line != tc.wantLine || serr.Column != tc.wantColumn {
+				t.Errorf("ParseText() = %v, want error at line %d, column %d", err, tc.wantLine, tc.wantColumn)
+			}
+		})
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	want := TextLevel{
+		State: State{
+			Bottles: []Bottle{
+				{Colors: []Color{1, 2}},
+				{Colors: []Color{2, 1}},
+				{Colors: []Color{Empty, Empty}, AcceptOnly: 1, NoPourOut: true},
+				{Colors: []Color{Empty, Empty}, LockedUntil: 1},
+			},
+			Palette: Palette{
+				{Name: "Teal", RGB: "#008080", Symbol: "T"},
+				{Name: "Rose", Symbol: "S"},
+			},
+		},
+		Header: map[string]string{
+			"name": "Custom colors",
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteText(&b, want); err != nil {
+		t.Fatal(err)
+	}
+
+	wantText := `@name Custom colors
+@color T Teal #008080
+@color S Rose
+TS
+ST
+.. accept=T no-pour-out
+.. locked=1
+`
+	if diff := cmp.Diff(wantText, b.String()); diff != "" {
+		t.Errorf("WriteText() differs (-want/+got):\n%s", diff)
+	}
+
+	got, err := ParseText(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseText() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestLoadLevel_DetectsFormat(t *testing.T) {
+	f, err := os.Open(filepath.Join("solver", "testdata", "level20.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	want, err := LoadLevel(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := WriteText(&b, TextLevel{State: want}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadLevel(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("LoadLevel(%q): %v", b.String(), err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadLevel() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestWriteText_ReservedSymbols(t *testing.T) {
+	for _, sym := range []string{"#", "@", ".", " ", "\u00a0", "", "TT"} {
+		l := TextLevel{
+			State: State{
+				Bottles: []Bottle{
+					{Colors: []Color{1, 1}},
+					{Colors: []Color{Empty, Empty}},
+				},
+				Palette: Palette{{Name: "Teal", Symbol: sym}},
+			},
+		}
+
+		var b strings.Builder
+		if err := WriteText(&b, l); err == nil {
+			t.Errorf("WriteText() with symbol %q succeeded, want error:\n%s", sym, b.String())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package watersort
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IssueKind identifies the kind of problem found by State.Validate.
+type IssueKind int
+
+const (
+	// NoBottles is reported for a level without any bottles.
+	NoBottles IssueKind = iota
+	// BottleSizeMismatch is reported for a bottle whose size differs from the first bottle.
+	BottleSizeMismatch
+	// StackedOnEmpty is reported for a color that sits on top of an empty slot.
+	StackedOnEmpty
+	// ColorCountMismatch is reported for a color (or Empty) that does not
+	// occur the expected number of times.
+	ColorCountMismatch
+	// ForeignColor is reported for a color in a bottle that only accepts another color.
+	ForeignColor
+	// UnknownAcceptOnly is reported for a bottle that only accepts a color
+	// that does not occur in the level.
+	UnknownAcceptOnly
+	// InvalidLock is reported for a bottle whose lock can never be opened.
+	InvalidLock
+	// InvalidRGB is reported for a palette color whose RGB value is not in
+	// the "#rrggbb" notation.
+	InvalidRGB
+	// NoSlots is reported for a level whose bottles have no slots.
+	NoSlots
+)
+
+var nameByIssueKind = map[IssueKind]string{
+	NoBottles:          "NoBottles",
+	BottleSizeMismatch: "BottleSizeMismatch",
+	StackedOnEmpty:     "StackedOnEmpty",
+	ColorCountMismatch: "ColorCountMismatch",
+	ForeignColor:       "ForeignColor",
+	UnknownAcceptOnly:  "UnknownAcceptOnly",
+	InvalidLock:        "InvalidLock",
+	InvalidRGB:         "InvalidRGB",
+	NoSlots:            "NoSlots",
+}
+
+func (k IssueKind) String() string {
+	if name, ok := nameByIssueKind[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("IssueKind(%d)", int(k))
+}
+
+// Issue is a single problem found by State.Validate.
+//
+// Bottle and Slot are 0-based indexes, or -1 if the issue does not refer to a
+// specific bottle or slot. Got and Want hold the counts for
+// BottleSizeMismatch and ColorCountMismatch issues. For InvalidLock issues,
+// they hold the number of done bottles the lock requires and the number of
+// bottles that can be done, i.e. the number of colors.
+type Issue struct {
+	Kind   IssueKind
+	Bottle int
+	Slot   int
+	Color  Color
+	Got    int
+	Want   int
+}
+
+func (i Issue) String() string {
+	return i.Format(nil)
+}
+
+// Format returns a description of the issue, using the color names of p.
+func (i Issue) Format(p Palette) string {
+	switch i.Kind {
+	case NoBottles:
+		return "level has no bottles"
+	case NoSlots:
+		return "bottles have no slots"
+	case BottleSizeMismatch:
+		return fmt.Sprintf("not all bottles have the same size: bottle %d has %d colors, want %d",
+			i.Bottle+1, i.Got, i.Want)
+	case StackedOnEmpty:
+		return fmt.Sprintf("bottle %d, slot %d: cannot stack color %s on top of empty",
+			i.Bottle+1, i.Slot+1, p.Name(i.Color))
+	case ColorCountMismatch:
+		if i.Color == Empty {
+			return fmt.Sprintf("got %d empty slots, want %d", i.Got, i.Want)
+		}
+		return fmt.Sprintf("color %s: got %d slots, want %d", p.Name(i.Color), i.Got, i.Want)
+	case ForeignColor:
+		return fmt.Sprintf("bottle %d, slot %d: color %s is not accepted by this bottle",
+			i.Bottle+1, i.Slot+1, p.Name(i.Color))
+	case UnknownAcceptOnly:
+		return fmt.Sprintf("bottle %d: only accepts %s, which is not part of the level",
+			i.Bottle+1, p.Name(i.Color))
+	case InvalidLock:
+		return fmt.Sprintf("bottle %d: locked until %d bottles are done, but at most %d bottles can be done",
+			i.Bottle+1, i.Got, i.Want)
+	case InvalidRGB:
+		return fmt.Sprintf("color %s: RGB value is not in the \"#rrggbb\" notation", p.Name(i.Color))
+	}
+	return fmt.Sprintf("%v: bottle %d, slot %d, color %s", i.Kind, i.Bottle+1, i.Slot+1, p.Name(i.Color))
+}
+
+// ValidationError is returned by State.Validate and LoadLevel when a level is
+// malformed. It lists all problems, not just the first one.
+type ValidationError struct {
+	Issues []Issue
+	// Palette is used to name colors in the error message.
+	Palette Palette
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.Format(e.Palette)
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/octo/watersort"
+	"github.com/octo/watersort/render"
+)
+
+// maxRequestSize is the maximum size of an API request body.
+const maxRequestSize = 1 << 20
+
+// Limits of generated levels and of the levels the server accepts.
+const (
+	maxColors       = 20
+	maxBottleSize   = 10
+	maxEmptyBottles = 4
+	maxBottles      = maxColors + maxEmptyBottles
+	// maxGIFSteps limits the length of animated solutions, which keep every
+	// frame in memory.
+	maxGIFSteps = 100
+)
+
+// apiHandler is like contextHandler, but reports errors as JSON:
+//
+//	{"error": {"status": 400, "message": "…"}}
+type apiHandler func(ctx context.Context, w http.ResponseWriter, req *http.Request) error
+
+func (hndl apiHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	err := hndl(req.Context(), w, req)
+	if err == nil {
+		return
+	}
+
+	var he httpError
+	if !errors.As(err, &he) {
+		log.Printf("%s: %v", req.RequestURI, err)
+		he = httpError{
+			msg:  "Internal server error",
+			code: http.StatusInternalServerError,
+		}
+	}
+	if he.code == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	he.setHeaders(w.Header())
+
+	writeJSON(w, he.code, apiErrorJSON{
+		Error: apiErrorDetailsJSON{
+			Status:  he.code,
+			Message: he.msg,
+		},
+	})
+}
+
+type apiErrorJSON struct {
+	Error apiErrorDetailsJSON `json:"error"`
+}
+
+type apiErrorDetailsJSON struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("json.Marshal(): %v", err)
+		http.Error(w, `{"error":{"status":500,"message":"Internal server error"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
+
+// decodeRequest reads the JSON body of a POST request into v.
+func decodeRequest(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	if req.Method != http.MethodPost {
+		return httpError{
+			msg:  fmt.Sprintf("method %s is not allowed, use POST", req.Method),
+			code: http.StatusMethodNotAllowed,
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return httpError{
+			msg:  "invalid request body: " + err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// levelRequest is the part of a request that describes a level. The level is
+// either given as a level code in "code", or in "level" as JSON or as a string
+// in the text format.
+type levelRequest struct {
+	Level   json.RawMessage   `json:"level,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Palette watersort.Palette `json:"palette,omitempty"`
+}
+
+// state parses the level without validating it.
+func (lr levelRequest) state() (watersort.State, error) {
+	var (
+		s   watersort.State
+		err error
+	)
+	switch {
+	case lr.Code != "":
+		s, err = watersort.DecodeCode(lr.Code)
+	case len(lr.Level) > 0 && lr.Level[0] == '"':
+		var text string
+		if err = json.Unmarshal(lr.Level, &text); err != nil {
+			break
+		}
+		var tl watersort.TextLevel
+		tl, err = watersort.ParseText(strings.NewReader(text))
+		s = tl.State
+	case len(lr.Level) > 0:
+		err = json.Unmarshal(lr.Level, &s)
+	default:
+		err = errors.New(`the required "level" or "code" field is missing`)
+	}
+	if err != nil {
+		return watersort.State{}, httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+
+	if err := checkLevelSize(s); err != nil {
+		return watersort.State{}, err
+	}
+
+	if lr.Palette != nil {
+		s.Palette = lr.Palette
+	}
+	return s, nil
+}
+
+// validState parses and validates the level.
+func (lr levelRequest) validState() (watersort.State, error) {
+	s, err := lr.state()
+	if err != nil {
+		return watersort.State{}, err
+	}
+
+	if err := s.Validate(); err != nil {
+		return watersort.State{}, httpError{
+			msg:  err.Error(),
+			code: http.StatusUnprocessableEntity,
+		}
+	}
+	return s, nil
+}
+
+type solveRequest struct {
+	levelRequest
+	WinCondition string `json:"win_condition,omitempty"`
+	ExtraBottle  bool   `json:"extra_bottle,omitempty"`
+}
+
+// solve parses the level and solves it with solve.
+func (sr solveRequest) solve(solve solveFunc) (watersort.State, []watersort.Step, watersort.SolutionFile, error) {
+	s, err := sr.validState()
+	if err != nil {
+		return watersort.State{}, nil, watersort.SolutionFile{}, err
+	}
+
+	steps, f, err := sr.solveState(s, solve)
+	if err != nil {
+		return watersort.State{}, nil, watersort.SolutionFile{}, err
+	}
+	return s, steps, f, nil
+}
+
+// solveState solves the valid level s with solve, using the request's win
+// condition and extra bottle.
+func (sr solveRequest) solveState(s watersort.State, solve solveFunc) ([]watersort.Step, watersort.SolutionFile, error) {
+	var err error
+	wc := watersort.DefaultWinCondition
+	if sr.WinCondition != "" {
+		wc, err = watersort.WinConditionByName(sr.WinCondition)
+		if err != nil {
+			return nil, watersort.SolutionFile{}, httpError{
+				msg:  err.Error(),
+				code: http.StatusBadRequest,
+			}
+		}
+	}
+
+	var complexity int
+	opts := []watersort.Option{
+		watersort.ReportComplexity(&complexity),
+		watersort.UseWinCondition(wc),
+	}
+	if sr.ExtraBottle {
+		opts = append(opts, watersort.AllowExtraBottle())
+	}
+
+	start := time.Now()
+	var steps []watersort.Step
+	if !wc.Won(s) {
+		steps, err = solve(s, opts...)
+		if err != nil {
+			return nil, watersort.SolutionFile{}, err
+		}
+	}
+
+	f, err := watersort.NewSolutionFile(s, steps, watersort.SolverStats{
+		StatesEvaluated: complexity,
+		Duration:        time.Since(start),
+	})
+	if err != nil {
+		return nil, watersort.SolutionFile{}, err
+	}
+	f.WinCondition = wc
+
+	return steps, f, nil
+}
+
+// APISolveHandler responds with the solution file of the level.
+func (s server) APISolveHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var sr solveRequest
+	if err := decodeRequest(w, req, &sr); err != nil {
+		return err
+	}
+
+	solve, release, err := s.solver(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, _, f, err := sr.solve(solve)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, f)
+	return nil
+}
+
+type hintResponse struct {
+	Solved         bool            `json:"solved"`
+	Step           json.RawMessage `json:"step,omitempty"`
+	Description    string          `json:"description,omitempty"`
+	RemainingSteps int             `json:"remaining_steps"`
+}
+
+// APIHintHandler responds with the next step of the solution.
+func (s server) APIHintHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var sr solveRequest
+	if err := decodeRequest(w, req, &sr); err != nil {
+		return err
+	}
+
+	solve, release, err := s.solver(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	state, steps, f, err := sr.solve(solve)
+	if err != nil {
+		return err
+	}
+
+	resp := hintResponse{
+		Solved:         len(steps) == 0,
+		RemainingSteps: len(steps),
+	}
+	if len(steps) > 0 {
+		// Use the step of the solution file, which has the color filled in.
+		step := f.Steps[0].Step
+		resp.Step, err = state.Palette.MarshalStep(step)
+		if err != nil {
+			return err
+		}
+		resp.Description = describeStep(state.Palette, step)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+type validateResponse struct {
+	Valid  bool        `json:"valid"`
+	Code   string      `json:"code,omitempty"`
+	Issues []issueJSON `json:"issues,omitempty"`
+}
+
+// issueJSON is the JSON representation of a watersort.Issue. Bottles and
+// slots are numbered from 1; zero means the issue does not refer to a
+// specific bottle or slot.
+type issueJSON struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Bottle  int    `json:"bottle,omitempty"`
+	Slot    int    `json:"slot,omitempty"`
+	Color   string `json:"color,omitempty"`
+}
+
+// APIValidateHandler checks the level and responds with all issues found.
+func (s server) APIValidateHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var lr levelRequest
+	if err := decodeRequest(w, req, &lr); err != nil {
+		return err
+	}
+
+	state, err := lr.state()
+	if err != nil {
+		return err
+	}
+
+	var resp validateResponse
+	err = state.Validate()
+	var verr *watersort.ValidationError
+	switch {
+	case err == nil:
+		resp.Valid = true
+		if code, err := watersort.EncodeCode(state); err == nil {
+			resp.Code = code
+		}
+	case errors.As(err, &verr):
+		for _, issue := range verr.Issues {
+			ij := issueJSON{
+				Kind:    issue.Kind.String(),
+				Message: issue.Format(state.Palette),
+				Bottle:  issue.Bottle + 1,
+				Slot:    issue.Slot + 1,
+			}
+			if issue.Color != watersort.Empty {
+				ij.Color = state.Palette.Name(issue.Color)
+			}
+			resp.Issues = append(resp.Issues, ij)
+		}
+	default:
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+type generateResponse struct {
+	Level      watersort.State `json:"level"`
+	Code       string          `json:"code"`
+	Seed       int64           `json:"seed"`
+	Difficulty int             `json:"difficulty,omitempty"`
+}
+
+// APIGenerateHandler responds with a random level.
+func (s server) APIGenerateHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	params := defaultGenerateParams()
+	if err := decodeRequest(w, req, &params); err != nil {
+		return err
+	}
+	if err := params.check(); err != nil {
+		return err
+	}
+
+	level, err := s.generate(ctx, req, params)
+	if err != nil {
+		return err
+	}
+
+	code, err := watersort.EncodeCode(level.State)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, generateResponse{
+		Level:      level.State,
+		Code:       code,
+		Seed:       level.Seed,
+		Difficulty: level.Difficulty,
+	})
+	return nil
+}
+
+type renderRequest struct {
+	levelRequest
+	Step   json.RawMessage `json:"step,omitempty"`
+	Format string          `json:"format,omitempty"`
+	// Symbols, Legend and Theme are passed to the renderer, see render.Options.
+	Symbols bool   `json:"symbols,omitempty"`
+	Legend  bool   `json:"legend,omitempty"`
+	Theme   string `json:"theme,omitempty"`
+}
+
+// APIRenderHandler responds with an SVG or PNG image of the level.
+func (s server) APIRenderHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var rr renderRequest
+	if err := decodeRequest(w, req, &rr); err != nil {
+		return err
+	}
+
+	state, err := rr.validState()
+	if err != nil {
+		return err
+	}
+
+	theme, err := parseTheme(rr.Theme)
+	if err != nil {
+		return err
+	}
+
+	opts := render.Options{
+		Highlight: true,
+		Symbols:   rr.Symbols,
+		Legend:    rr.Legend,
+		Theme:     theme,
+	}
+	if len(rr.Step) > 0 {
+		step, err := state.Palette.UnmarshalStep(rr.Step)
+		if err != nil {
+			return httpError{
+				msg:  "invalid step: " + err.Error(),
+				code: http.StatusBadRequest,
+			}
+		}
+		opts.Step = &step
+	}
+
+	var buf bytes.Buffer
+	switch rr.Format {
+	case "", "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = render.SVG(&buf, state, opts)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		err = render.PNG(&buf, state, opts)
+	default:
+		return httpError{
+			msg:  fmt.Sprintf(`unknown format %q, want "svg" or "png"`, rr.Format),
+			code: http.StatusBadRequest,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// OpenAPIHandler serves the OpenAPI description of the API.
+func (s server) OpenAPIHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, req, "openapi.json")
+	return nil
+}
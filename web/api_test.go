@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/octo/watersort"
+)
+
+// serveAPI sends body to hndl and returns the status code and response body.
+func serveAPI(t *testing.T, hndl apiHandler, body string) (int, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	hndl.ServeHTTP(w, req)
+
+	if got, want := w.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	return w.Code, w.Body.Bytes()
+}
+
+// apiLevels returns request bodies for the API tests, keyed by name.
+func apiLevels(t *testing.T) map[string]string {
+	t.Helper()
+
+	level, _, _ := testLevel(t)
+	oversized := watersort.State{Bottles: make([]watersort.Bottle, maxBottles+1)}
+	for i := range oversized.Bottles {
+		oversized.Bottles[i].Colors = make([]watersort.Color, 2)
+	}
+
+	ret := map[string]string{
+		"no slots": `{"level": [[]]}`,
+		// A valid level without a solution.
+		"unsolvable": `{"level": [["Blue","Brown","DarkBlue"],["Blue","Brown","Brown"],["DarkBlue","Blue","DarkBlue"],["Empty","Empty","Empty"]]}`,
+	}
+	for name, s := range map[string]watersort.State{
+		"valid":     level,
+		"oversized": oversized,
+	} {
+		data, err := json.Marshal(levelRequest{Level: mustMarshal(t, s)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret[name] = string(data)
+	}
+	return ret
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkAPIError checks that body is a JSON error with the status code. If
+// wantMessage is not empty, the error message must contain it.
+func checkAPIError(t *testing.T, body []byte, wantCode int, wantMessage string) {
+	t.Helper()
+
+	var resp apiErrorJSON
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("json.Unmarshal(%q) = %v", body, err)
+	}
+	if resp.Error.Status != wantCode {
+		t.Errorf("error status = %d, want %d", resp.Error.Status, wantCode)
+	}
+	if resp.Error.Message == "" || !strings.Contains(resp.Error.Message, wantMessage) {
+		t.Errorf("error message = %q, want it to contain %q", resp.Error.Message, wantMessage)
+	}
+}
+
+func TestAPISolveHandler(t *testing.T) {
+	s := server{limiter: newSolveLimiter(solveLimits{})}
+	levels := apiLevels(t)
+	_, _, steps := testLevel(t)
+
+	cases := []struct {
+		name        string
+		body        string
+		wantCode    int
+		wantMessage string
+	}{
+		{name: "valid", body: levels["valid"], wantCode: http.StatusOK},
+		{name: "no slots", body: levels["no slots"], wantCode: http.StatusUnprocessableEntity, wantMessage: "bottles have no slots"},
+		{name: "oversized", body: levels["oversized"], wantCode: http.StatusRequestEntityTooLarge},
+		{name: "unsolvable", body: levels["unsolvable"], wantCode: http.StatusUnprocessableEntity, wantMessage: "the level cannot be solved"},
+		{name: "invalid JSON", body: `{"level": `, wantCode: http.StatusBadRequest, wantMessage: "invalid request body"},
+		{name: "missing level", body: `{}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, body := serveAPI(t, apiHandler(s.APISolveHandler), tc.body)
+			if code != tc.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tc.wantCode, body)
+			}
+			if tc.wantCode != http.StatusOK {
+				checkAPIError(t, body, tc.wantCode, tc.wantMessage)
+				return
+			}
+
+			var f watersort.SolutionFile
+			if err := json.Unmarshal(body, &f); err != nil {
+				t.Fatalf("json.Unmarshal(%q) = %v", body, err)
+			}
+			if got, want := len(f.Steps), len(steps); got != want {
+				t.Errorf("got %d steps, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestAPIValidateHandler(t *testing.T) {
+	s := server{limiter: newSolveLimiter(solveLimits{})}
+	levels := apiLevels(t)
+
+	cases := []struct {
+		name      string
+		body      string
+		wantCode  int
+		wantValid bool
+		wantKinds []string
+	}{
+		{name: "valid", body: levels["valid"], wantCode: http.StatusOK, wantValid: true},
+		// Validation does not solve the level.
+		{name: "unsolvable", body: levels["unsolvable"], wantCode: http.StatusOK, wantValid: true},
+		{name: "no slots", body: levels["no slots"], wantCode: http.StatusOK, wantKinds: []string{watersort.NoSlots.String()}},
+		{name: "oversized", body: levels["oversized"], wantCode: http.StatusRequestEntityTooLarge},
+		{name: "invalid JSON", body: `{"level": `, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, body := serveAPI(t, apiHandler(s.APIValidateHandler), tc.body)
+			if code != tc.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tc.wantCode, body)
+			}
+			if tc.wantCode != http.StatusOK {
+				checkAPIError(t, body, tc.wantCode, "")
+				return
+			}
+
+			var resp validateResponse
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("json.Unmarshal(%q) = %v", body, err)
+			}
+			if resp.Valid != tc.wantValid {
+				t.Errorf("Valid = %v, want %v", resp.Valid, tc.wantValid)
+			}
+			if resp.Valid && resp.Code == "" {
+				t.Error("Code is empty for a valid level")
+			}
+			var gotKinds []string
+			for _, issue := range resp.Issues {
+				gotKinds = append(gotKinds, issue.Kind)
+			}
+			if strings.Join(gotKinds, ",") != strings.Join(tc.wantKinds, ",") {
+				t.Errorf("issue kinds = %v, want %v", gotKinds, tc.wantKinds)
+			}
+		})
+	}
+}
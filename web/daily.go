@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// The daily puzzle is the same level for everyone on a given day. It is
+// generated with a seed derived from the date, see dailySeed, and stored
+// together with the day's completion stats, so that a day's puzzle does not
+// change when the generator does.
+const dailyDateLayout = "2006-01-02"
+
+// The daily puzzles' difficulty is the length of their shortest solution, see
+// measureDifficulty. It only depends on the level, so that a date always
+// yields the same puzzle, even if it is not stored.
+const (
+	dailyColors       = 10
+	dailySize         = 4
+	dailyEmptyBottles = 2
+	dailyMinMoves     = 32
+	dailyMaxMoves     = 35
+)
+
+// dailySeed returns the seed of the puzzle of date, e.g. 20261019000 for
+// 2026-10-19. The seeds are far enough apart that the attempts of one day never
+// use the seeds of the next, see maxGenerateAttempts.
+func dailySeed(date time.Time) int64 {
+	y, m, d := date.Date()
+	return int64(y*10000+int(m)*100+d) * 1000
+}
+
+// dailyRecord is the puzzle of one day and its completion stats.
+type dailyRecord struct {
+	Code string `json:"code"`
+	Seed int64  `json:"seed"`
+	// Optimal is the length of the shortest solution, which may use the
+	// extra bottle.
+	Optimal int `json:"optimal"`
+	// Completions counts the completed games by their number of moves.
+	Completions map[int]int `json:"completions,omitempty"`
+}
+
+// Total returns the number of completed games.
+func (r dailyRecord) Total() int {
+	var n int
+	for _, count := range r.Completions {
+		n += count
+	}
+	return n
+}
+
+// TotalOptimal returns the number of games completed with the shortest
+// solution's number of moves or fewer.
+func (r dailyRecord) TotalOptimal() int {
+	var n int
+	for moves, count := range r.Completions {
+		if moves <= r.Optimal {
+			n += count
+		}
+	}
+	return n
+}
+
+type dailyMoveCount struct {
+	Moves, Games int
+}
+
+// MoveCounts returns the completed games by number of moves, fewest moves
+// first.
+func (r dailyRecord) MoveCounts() []dailyMoveCount {
+	var ret []dailyMoveCount
+	for moves, count := range r.Completions {
+		ret = append(ret, dailyMoveCount{Moves: moves, Games: count})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Moves < ret[j].Moves })
+	return ret
+}
+
+func (r dailyRecord) clone() dailyRecord {
+	completions := r.Completions
+	r.Completions = make(map[int]int, len(completions))
+	for moves, count := range completions {
+		r.Completions[moves] = count
+	}
+	return r
+}
+
+// dailyStore keeps the daily puzzles in a JSON file, keyed by date. With an
+// empty path, the puzzles are only kept in memory.
+type dailyStore struct {
+	path string
+
+	mu   sync.Mutex
+	days map[string]dailyRecord
+}
+
+func newDailyStore(path string) (*dailyStore, error) {
+	ds := &dailyStore{
+		path: path,
+		days: make(map[string]dailyRecord),
+	}
+	if path == "" {
+		return ds, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ds.days); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ds, nil
+}
+
+// get returns a copy of the record of date.
+func (ds *dailyStore) get(date string) (dailyRecord, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	r, ok := ds.days[date]
+	return r.clone(), ok
+}
+
+// add stores the puzzle of date, unless one is stored already. It returns
+// the stored record.
+func (ds *dailyStore) add(date string, r dailyRecord) (dailyRecord, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if stored, ok := ds.days[date]; ok {
+		return stored.clone(), nil
+	}
+	ds.days[date] = r
+	return r.clone(), ds.write()
+}
+
+// complete records a game of date's puzzle completed in moves moves.
+func (ds *dailyStore) complete(date string, moves int) (dailyRecord, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	r, ok := ds.days[date]
+	if !ok {
+		return dailyRecord{}, fmt.Errorf("no daily puzzle for %s", date)
+	}
+	r = r.clone()
+	if r.Completions == nil {
+		r.Completions = make(map[int]int)
+	}
+	r.Completions[moves]++
+	ds.days[date] = r
+
+	return r.clone(), ds.write()
+}
+
+// write replaces the store's file. ds.mu must be held.
+func (ds *dailyStore) write() error {
+	if ds.path == "" {
+		return nil
+	}
+	return replaceFile(ds.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ds.days)
+	})
+}
+
+// generateDaily generates the puzzle of date. Levels are generated with
+// consecutive seeds until one has a shortest solution of dailyMinMoves to
+// dailyMaxMoves moves.
+func generateDaily(solve solveFunc, date time.Time) (dailyRecord, error) {
+	seed := dailySeed(date)
+	for i := int64(0); i < maxGenerateAttempts; i++ {
+		s := watersort.GenerateState(rand.New(rand.NewSource(seed+i)), dailyColors, dailySize, dailyEmptyBottles)
+
+		moves, ok, err := measureDifficulty(solve, s)
+		if err != nil {
+			return dailyRecord{}, err
+		}
+		if !ok || moves < dailyMinMoves || moves > dailyMaxMoves {
+			continue
+		}
+
+		code, err := watersort.EncodeCode(s)
+		if err != nil {
+			return dailyRecord{}, err
+		}
+		return dailyRecord{
+			Code:    code,
+			Seed:    seed + i,
+			Optimal: moves,
+		}, nil
+	}
+
+	return dailyRecord{}, fmt.Errorf("no daily puzzle for %s was found in %d attempts", date.Format(dailyDateLayout), maxGenerateAttempts)
+}
+
+// dailyLevel returns the puzzle of date, generating it if it is not stored
+// yet.
+func (s server) dailyLevel(ctx context.Context, req *http.Request, date time.Time) (dailyRecord, watersort.State, error) {
+	key := date.Format(dailyDateLayout)
+
+	r, ok := s.daily.get(key)
+	if !ok {
+		solve, release, err := s.solver(ctx, req)
+		if err != nil {
+			return dailyRecord{}, watersort.State{}, err
+		}
+		r, err = generateDaily(solve, date)
+		release()
+		if err != nil {
+			return dailyRecord{}, watersort.State{}, err
+		}
+
+		if r, err = s.daily.add(key, r); err != nil {
+			return dailyRecord{}, watersort.State{}, err
+		}
+	}
+
+	state, err := watersort.DecodeCode(r.Code)
+	if err != nil {
+		return dailyRecord{}, watersort.State{}, fmt.Errorf("daily puzzle %s: %w", key, err)
+	}
+	return r, state, nil
+}
+
+// DailyHandler serves the daily puzzle at "/daily/<date>", e.g.
+// "/daily/2026-10-19"; "/daily" redirects to today's puzzle. Dates are in UTC.
+// POST requests submit a game: the "moves" parameter, as in the play URL, must
+// solve the puzzle. The game is added to the day's stats.
+func (s server) DailyHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	name := strings.Trim(strings.TrimPrefix(req.URL.Path, "/daily"), "/")
+	if name == "" {
+		http.Redirect(w, req, "/daily/"+today.Format(dailyDateLayout), http.StatusFound)
+		return nil
+	}
+
+	date, err := time.Parse(dailyDateLayout, name)
+	if err != nil {
+		return httpError{
+			msg:  fmt.Sprintf("invalid date %q, want YYYY-MM-DD", name),
+			code: http.StatusNotFound,
+		}
+	}
+	if date.After(today) {
+		return httpError{
+			msg:  fmt.Sprintf("the daily puzzle of %s is not available yet", name),
+			code: http.StatusNotFound,
+		}
+	}
+	dayURL := "/daily/" + date.Format(dailyDateLayout)
+
+	r, level, err := s.dailyLevel(ctx, req, date)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodPost {
+		g, err := replay(level, req)
+		if err != nil {
+			return err
+		}
+		if !g.Won() {
+			return httpError{
+				msg:  "the moves do not solve the daily puzzle",
+				code: http.StatusBadRequest,
+			}
+		}
+		if _, err := s.daily.complete(date.Format(dailyDateLayout), g.Moves()); err != nil {
+			return err
+		}
+
+		// Redirect, so that reloading the page does not submit the game again.
+		http.Redirect(w, req, dayURL+"?result="+strconv.Itoa(g.Moves()), http.StatusSeeOther)
+		return nil
+	}
+
+	play, err := playURL(level, nil, "daily", date.Format(dailyDateLayout))
+	if err != nil {
+		return err
+	}
+
+	board, err := leaderboardURL(level)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Date           string
+		Record         dailyRecord
+		PlayURL        string
+		LeaderboardURL string
+		// Result is the number of moves of the game just submitted, or 0.
+		Result  int
+		PrevURL string
+		NextURL string
+	}{
+		Date:           date.Format(dailyDateLayout),
+		Record:         r,
+		PlayURL:        play,
+		LeaderboardURL: board,
+		PrevURL:        "/daily/" + date.AddDate(0, 0, -1).Format(dailyDateLayout),
+	}
+	if next := date.AddDate(0, 0, 1); !next.After(today) {
+		data.NextURL = "/daily/" + next.Format(dailyDateLayout)
+	}
+	if result, err := strconv.Atoi(req.FormValue("result")); err == nil && result > 0 {
+		data.Result = result
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "daily.html", data)
+}
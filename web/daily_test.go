@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+)
+
+func TestDailySeed(t *testing.T) {
+	cases := []struct {
+		date string
+		want int64
+	}{
+		{date: "2026-10-19", want: 20261019000},
+		{date: "2026-01-01", want: 20260101000},
+		{date: "2025-12-31", want: 20251231000},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.date, func(t *testing.T) {
+			date, err := time.Parse(dailyDateLayout, tc.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dailySeed(date); got != tc.want {
+				t.Errorf("dailySeed(%s) = %d, want %d", tc.date, got, tc.want)
+			}
+			// The attempts of one day must not use the seeds of the next.
+			if next := dailySeed(date.AddDate(0, 0, 1)); next < tc.want+maxGenerateAttempts {
+				t.Errorf("dailySeed() of the next day = %d, want at least %d", next, tc.want+maxGenerateAttempts)
+			}
+		})
+	}
+}
+
+func TestGenerateDaily_Reproducible(t *testing.T) {
+	solve := func(s watersort.State, opts ...watersort.Option) ([]watersort.Step, error) {
+		return s.Solve(opts...)
+	}
+	date := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	want, err := generateDaily(solve, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Optimal < dailyMinMoves || want.Optimal > dailyMaxMoves {
+		t.Errorf("Optimal = %d, want %d to %d", want.Optimal, dailyMinMoves, dailyMaxMoves)
+	}
+
+	for i := 0; i < 5; i++ {
+		got, err := generateDaily(solve, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("generateDaily() differs between runs (-want/+got):\n%s", diff)
+		}
+	}
+}
+
+func TestDailyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+
+	ds, err := newDailyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.get("2026-10-19"); ok {
+		t.Error("get() of an empty store succeeded")
+	}
+	if _, err := ds.complete("2026-10-19", 30); err == nil {
+		t.Error("complete() of a missing day succeeded, want error")
+	}
+
+	want := dailyRecord{Code: "first", Seed: 1, Optimal: 30}
+	if _, err := ds.add("2026-10-19", want); err != nil {
+		t.Fatal(err)
+	}
+	// Adding a day again keeps the first puzzle.
+	got, err := ds.add("2026-10-19", dailyRecord{Code: "second", Seed: 2, Optimal: 31})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != want.Code {
+		t.Errorf("add() of an existing day = %q, want %q", got.Code, want.Code)
+	}
+
+	for _, moves := range []int{30, 34, 30, 29} {
+		if got, err = ds.complete("2026-10-19", moves); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want.Completions = map[int]int{29: 1, 30: 2, 34: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("complete() differs (-want/+got):\n%s", diff)
+	}
+	if got, want := got.Total(), 4; got != want {
+		t.Errorf("Total() = %d, want %d", got, want)
+	}
+	if got, want := got.TotalOptimal(), 3; got != want {
+		t.Errorf("TotalOptimal() = %d, want %d", got, want)
+	}
+	wantCounts := []dailyMoveCount{{29, 1}, {30, 2}, {34, 1}}
+	if diff := cmp.Diff(wantCounts, got.MoveCounts()); diff != "" {
+		t.Errorf("MoveCounts() differs (-want/+got):\n%s", diff)
+	}
+
+	// Records are copies.
+	got.Completions[30] = 100
+	if got, _ := ds.get("2026-10-19"); got.Completions[30] != 2 {
+		t.Errorf("changing a returned record changed the store: %d completions with 30 moves, want 2", got.Completions[30])
+	}
+
+	reopened, err := newDailyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.get("2026-10-19")
+	if !ok {
+		t.Fatal("get() after reopening the store failed")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("record differs after reopening the store (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/octo/watersort"
+)
+
+type editorColor struct {
+	Name   string `json:"name"`
+	RGB    string `json:"rgb"`
+	Symbol string `json:"symbol"`
+}
+
+// EditorHandler serves the level editor. If the request has a level, it is
+// loaded into the editor.
+func (s server) EditorHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var level watersort.State
+	for i := 0; i < 7; i++ {
+		level.Bottles = append(level.Bottles, watersort.Bottle{
+			Colors: make([]watersort.Color, 4),
+		})
+	}
+
+	if req.FormValue("code") != "" || req.FormValue("state") != "" {
+		var err error
+		level, err = parseState(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	palette := level.Palette
+	if palette == nil {
+		palette = watersort.DefaultPalette
+	}
+
+	// The editor's colors are the palette's colors, preceded by Empty.
+	colors := []editorColor{{
+		Name: palette.Name(watersort.Empty),
+		RGB:  palette.RGB(watersort.Empty),
+	}}
+	for i := range palette {
+		c := watersort.Color(i + 1)
+		colors = append(colors, editorColor{
+			Name:   palette.Name(c),
+			RGB:    palette.RGB(c),
+			Symbol: palette.Symbol(c),
+		})
+	}
+
+	// Bottles are passed to the editor as lists of color indexes into colors.
+	var bottles [][]int
+	for _, b := range level.Bottles {
+		var slots []int
+		for _, c := range b.Colors {
+			slots = append(slots, int(c))
+		}
+		bottles = append(bottles, slots)
+	}
+
+	data := struct {
+		Colors     []editorColor
+		Bottles    [][]int
+		Palette    watersort.Palette
+		CanSave    bool
+		MaxBottles int
+		MaxSize    int
+	}{
+		Colors:     colors,
+		Bottles:    bottles,
+		Palette:    level.Palette,
+		CanSave:    s.packs != nil,
+		MaxBottles: maxBottles,
+		MaxSize:    maxBottleSize,
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "editor.html", data)
+}
+
+type saveRequest struct {
+	levelRequest
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source,omitempty"`
+	Number int    `json:"number,omitempty"`
+	Author string `json:"author,omitempty"`
+}
+
+type saveResponse struct {
+	ID            string `json:"id"`
+	OptimalLength int    `json:"optimal_length"`
+}
+
+// EditorSaveHandler solves the level, allowing the extra bottle, and adds it,
+// together with its solution, to the level pack given with -pack.
+func (s server) EditorSaveHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	if s.packs == nil {
+		return httpError{
+			msg:  "saving levels is disabled; start the server with -pack",
+			code: http.StatusNotImplemented,
+		}
+	}
+
+	var sr saveRequest
+	if err := decodeRequest(w, req, &sr); err != nil {
+		return err
+	}
+
+	state, err := sr.validState()
+	if err != nil {
+		return err
+	}
+
+	solve, release, err := s.solver(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Solve with the same options as the play mode, so that levels that
+	// need the extra bottle can be saved, too.
+	steps, err := solve(state, watersort.AllowExtraBottle())
+	if err != nil {
+		return err
+	}
+
+	l, err := s.packs.add(watersort.Level{
+		ID:            sr.ID,
+		Name:          sr.Name,
+		Source:        sr.Source,
+		Number:        sr.Number,
+		Author:        sr.Author,
+		OptimalLength: len(steps),
+		Solution:      steps,
+		State:         state,
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, saveResponse{
+		ID:            l.ID,
+		OptimalLength: l.OptimalLength,
+	})
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// maxGenerateAttempts is the number of levels generated when looking for one
+// in the requested difficulty range.
+const maxGenerateAttempts = 100
+
+// maxGenerateStates is the number of states the solver may evaluate when
+// measuring the difficulty of a generated level. Levels that need more are
+// skipped. The solver is deterministic, so as long as the server's state
+// limit is not lower, this only depends on the level.
+const maxGenerateStates = 100000
+
+// measureDifficulty returns the number of moves of the shortest solution of s,
+// using the extra bottle like play mode does. ok is false if s cannot be solved
+// or needs more than maxGenerateStates states to solve.
+func measureDifficulty(solve solveFunc, s watersort.State) (moves int, ok bool, err error) {
+	var states int
+	steps, err := solve(s, watersort.AllowExtraBottle(), watersort.ReportComplexity(&states))
+	if errors.Is(err, watersort.ErrNoSolution) || errors.Is(err, watersort.ErrStateLimit) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if states >= maxGenerateStates {
+		return 0, false, nil
+	}
+	return len(steps), true, nil
+}
+
+// generateParams describes the level to generate. Difficulty is the number of
+// moves of the shortest solution, see measureDifficulty. A MaxDifficulty of
+// zero means no upper limit.
+type generateParams struct {
+	Colors        int    `json:"colors,omitempty"`
+	Size          int    `json:"size,omitempty"`
+	EmptyBottles  int    `json:"empty_bottles,omitempty"`
+	Seed          *int64 `json:"seed,omitempty"`
+	MinDifficulty int    `json:"min_difficulty,omitempty"`
+	MaxDifficulty int    `json:"max_difficulty,omitempty"`
+}
+
+func defaultGenerateParams() generateParams {
+	return generateParams{
+		Colors:       10,
+		Size:         4,
+		EmptyBottles: 2,
+	}
+}
+
+// parseGenerateParams reads the "colors", "size", "empty", "seed",
+// "min_difficulty" and "max_difficulty" query parameters.
+func parseGenerateParams(req *http.Request) (generateParams, error) {
+	p := defaultGenerateParams()
+
+	for _, param := range []struct {
+		name string
+		ptr  *int
+	}{
+		{"colors", &p.Colors},
+		{"size", &p.Size},
+		{"empty", &p.EmptyBottles},
+		{"min_difficulty", &p.MinDifficulty},
+		{"max_difficulty", &p.MaxDifficulty},
+	} {
+		v := req.FormValue(param.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return generateParams{}, httpError{
+				msg:  fmt.Sprintf("invalid %q parameter: %q is not a number", param.name, v),
+				code: http.StatusBadRequest,
+			}
+		}
+		*param.ptr = n
+	}
+
+	if v := req.FormValue("seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return generateParams{}, httpError{
+				msg:  fmt.Sprintf("invalid \"seed\" parameter: %q is not a number", v),
+				code: http.StatusBadRequest,
+			}
+		}
+		p.Seed = &seed
+	}
+
+	return p, p.check()
+}
+
+func (p generateParams) check() error {
+	var msg string
+	switch {
+	case p.Colors < 2 || p.Colors > maxColors:
+		msg = fmt.Sprintf("colors must be between 2 and %d", maxColors)
+	case p.Size < 2 || p.Size > maxBottleSize:
+		msg = fmt.Sprintf("size must be between 2 and %d", maxBottleSize)
+	case p.EmptyBottles < 1 || p.EmptyBottles > maxEmptyBottles:
+		msg = fmt.Sprintf("the number of empty bottles must be between 1 and %d", maxEmptyBottles)
+	case p.MinDifficulty < 0 || p.MaxDifficulty < 0:
+		msg = "difficulties must not be negative"
+	case p.MaxDifficulty != 0 && p.MaxDifficulty < p.MinDifficulty:
+		msg = "the maximum difficulty must not be smaller than the minimum difficulty"
+	default:
+		return nil
+	}
+
+	return httpError{
+		msg:  msg,
+		code: http.StatusBadRequest,
+	}
+}
+
+func (p generateParams) hasDifficulty() bool {
+	return p.MinDifficulty != 0 || p.MaxDifficulty != 0
+}
+
+// values returns the query parameters that reproduce the level generated
+// with seed.
+func (p generateParams) values(seed int64) url.Values {
+	values := make(url.Values)
+	values.Set("colors", strconv.Itoa(p.Colors))
+	values.Set("size", strconv.Itoa(p.Size))
+	values.Set("empty", strconv.Itoa(p.EmptyBottles))
+	values.Set("seed", strconv.FormatInt(seed, 10))
+	if p.MinDifficulty != 0 {
+		values.Set("min_difficulty", strconv.Itoa(p.MinDifficulty))
+	}
+	if p.MaxDifficulty != 0 {
+		values.Set("max_difficulty", strconv.Itoa(p.MaxDifficulty))
+	}
+	return values
+}
+
+type generatedLevel struct {
+	State watersort.State
+	// Seed reproduces State with the same parameters on the first attempt.
+	Seed int64
+	// Difficulty is only set if a difficulty range was requested.
+	Difficulty int
+}
+
+// generate returns a random level. If a difficulty range is requested, levels
+// are generated with consecutive seeds until one is solved by solve and within
+// the range. The same parameters and seed always yield the same level, unless
+// solving takes longer than the request may.
+func (p generateParams) generate(solve solveFunc) (generatedLevel, error) {
+	seed := time.Now().UnixNano()
+	if p.Seed != nil {
+		seed = *p.Seed
+	}
+
+	if !p.hasDifficulty() {
+		return generatedLevel{
+			State: watersort.GenerateState(rand.New(rand.NewSource(seed)), p.Colors, p.Size, p.EmptyBottles),
+			Seed:  seed,
+		}, nil
+	}
+
+	for i := int64(0); i < maxGenerateAttempts; i++ {
+		s := watersort.GenerateState(rand.New(rand.NewSource(seed+i)), p.Colors, p.Size, p.EmptyBottles)
+
+		moves, ok, err := measureDifficulty(solve, s)
+		if err != nil {
+			return generatedLevel{}, err
+		}
+		if !ok || moves < p.MinDifficulty || (p.MaxDifficulty != 0 && moves > p.MaxDifficulty) {
+			continue
+		}
+
+		return generatedLevel{
+			State:      s,
+			Seed:       seed + i,
+			Difficulty: moves,
+		}, nil
+	}
+
+	return generatedLevel{}, httpError{
+		msg:  fmt.Sprintf("no level in the requested difficulty range was found in %d attempts", maxGenerateAttempts),
+		code: http.StatusUnprocessableEntity,
+	}
+}
+
+// generate generates a level with p. Requests with a difficulty range are
+// subject to the solve limits.
+func (s server) generate(ctx context.Context, req *http.Request, p generateParams) (generatedLevel, error) {
+	if !p.hasDifficulty() {
+		return p.generate(nil)
+	}
+
+	solve, release, err := s.solver(ctx, req)
+	if err != nil {
+		return generatedLevel{}, err
+	}
+	defer release()
+
+	return p.generate(solve)
+}
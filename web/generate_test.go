@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+)
+
+func TestGenerateParamsCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(*generateParams)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(p *generateParams) {}},
+		{name: "smallest", modify: func(p *generateParams) { p.Colors, p.Size, p.EmptyBottles = 2, 2, 1 }},
+		{name: "largest", modify: func(p *generateParams) { p.Colors, p.Size, p.EmptyBottles = maxColors, maxBottleSize, maxEmptyBottles }},
+		{name: "difficulty range", modify: func(p *generateParams) { p.MinDifficulty, p.MaxDifficulty = 20, 30 }},
+		{name: "no maximum difficulty", modify: func(p *generateParams) { p.MinDifficulty = 20 }},
+		{name: "one color", modify: func(p *generateParams) { p.Colors = 1 }, wantErr: true},
+		{name: "too many colors", modify: func(p *generateParams) { p.Colors = maxColors + 1 }, wantErr: true},
+		{name: "bottles too small", modify: func(p *generateParams) { p.Size = 1 }, wantErr: true},
+		{name: "bottles too large", modify: func(p *generateParams) { p.Size = maxBottleSize + 1 }, wantErr: true},
+		{name: "no empty bottles", modify: func(p *generateParams) { p.EmptyBottles = 0 }, wantErr: true},
+		{name: "too many empty bottles", modify: func(p *generateParams) { p.EmptyBottles = maxEmptyBottles + 1 }, wantErr: true},
+		{name: "negative difficulty", modify: func(p *generateParams) { p.MinDifficulty = -1 }, wantErr: true},
+		{name: "inverted range", modify: func(p *generateParams) { p.MinDifficulty, p.MaxDifficulty = 30, 20 }, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := defaultGenerateParams()
+			tc.modify(&p)
+
+			err := p.check()
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("check() = %v, want nil", err)
+				}
+				return
+			}
+
+			var he httpError
+			if !errors.As(err, &he) || he.code != http.StatusBadRequest {
+				t.Errorf("check() = %v, want a %d error", err, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestParseGenerateParams(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/gen?colors=6&size=3&empty=1&seed=-42&min_difficulty=10", nil)
+	got, err := parseGenerateParams(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := int64(-42)
+	want := generateParams{Colors: 6, Size: 3, EmptyBottles: 1, Seed: &seed, MinDifficulty: 10}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseGenerateParams() differs (-want/+got):\n%s", diff)
+	}
+
+	for _, query := range []string{"colors=ten", "seed=1.5", "size=100"} {
+		req := httptest.NewRequest(http.MethodGet, "/gen?"+query, nil)
+		if _, err := parseGenerateParams(req); err == nil {
+			t.Errorf("parseGenerateParams(%q) succeeded, want error", query)
+		}
+	}
+}
+
+func TestGenerateParamsGenerate_Reproducible(t *testing.T) {
+	solve := func(s watersort.State, opts ...watersort.Option) ([]watersort.Step, error) {
+		return s.Solve(opts...)
+	}
+
+	for _, seed := range []int64{14, 42} {
+		seed := seed
+		p := generateParams{
+			Colors:        6,
+			Size:          4,
+			EmptyBottles:  2,
+			Seed:          &seed,
+			MinDifficulty: 15,
+		}
+
+		want, err := p.generate(solve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want.Difficulty < p.MinDifficulty {
+			t.Errorf("seed %d: Difficulty = %d, want at least %d", seed, want.Difficulty, p.MinDifficulty)
+		}
+
+		for i := 0; i < 20; i++ {
+			got, err := p.generate(solve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("seed %d: generate() differs between runs (-want/+got):\n%s", seed, diff)
+			}
+		}
+	}
+}
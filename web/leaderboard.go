@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/octo/watersort"
+)
+
+// maxNicknameLength is the maximum length of a nickname, in characters.
+const maxNicknameLength = 32
+
+// leaderboardEntry is a game that won a level. Moves and DurationMS have been
+// verified by the server.
+type leaderboardEntry struct {
+	Nickname string `json:"nickname"`
+	Moves    int    `json:"moves"`
+	// DurationMS is the time from opening the level to the winning move.
+	DurationMS int64 `json:"duration_ms"`
+	// MoveList is the game's moves in the format of the play URL.
+	MoveList  string    `json:"move_list"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// Time returns the duration rounded to seconds, e.g. "2m5s".
+func (e leaderboardEntry) Time() string {
+	d := time.Duration(e.DurationMS) * time.Millisecond
+	return d.Round(time.Second).String()
+}
+
+// leaderboardStorage stores the leaderboards, one per level. Levels are
+// identified by their level code. Implementations must be safe for concurrent
+// use.
+type leaderboardStorage interface {
+	// Add adds e to the leaderboard of level.
+	Add(level string, e leaderboardEntry) error
+	// Entries returns the entries of level's leaderboard in any order.
+	Entries(level string) ([]leaderboardEntry, error)
+	// Levels returns the levels that have a leaderboard.
+	Levels() ([]string, error)
+}
+
+// fileLeaderboard is the default leaderboardStorage. It keeps all leaderboards
+// in memory and, if path is not empty, in a JSON file.
+type fileLeaderboard struct {
+	path string
+
+	mu     sync.Mutex
+	boards map[string][]leaderboardEntry
+}
+
+// newFileLeaderboard returns a leaderboardStorage using the file at path. The
+// file is created with the first entry.
+func newFileLeaderboard(path string) (*fileLeaderboard, error) {
+	fl := &fileLeaderboard{
+		path:   path,
+		boards: make(map[string][]leaderboardEntry),
+	}
+	if path == "" {
+		return fl, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fl.boards); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fl, nil
+}
+
+func (fl *fileLeaderboard) Add(level string, e leaderboardEntry) error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	fl.boards[level] = append(fl.boards[level], e)
+	if fl.path == "" {
+		return nil
+	}
+	return replaceFile(fl.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fl.boards)
+	})
+}
+
+func (fl *fileLeaderboard) Entries(level string) ([]leaderboardEntry, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	return append([]leaderboardEntry(nil), fl.boards[level]...), nil
+}
+
+func (fl *fileLeaderboard) Levels() ([]string, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	var levels []string
+	for level := range fl.boards {
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// rankEntries sorts entries from best to worst: fewest moves first, then the
+// fastest, then the earliest.
+func rankEntries(entries []leaderboardEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Moves != b.Moves {
+			return a.Moves < b.Moves
+		}
+		if a.DurationMS != b.DurationMS {
+			return a.DurationMS < b.DurationMS
+		}
+		return a.Submitted.Before(b.Submitted)
+	})
+}
+
+// parseNickname returns the trimmed nickname, or an error if it is empty,
+// too long or contains unprintable characters.
+func parseNickname(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	var msg string
+	switch {
+	case s == "":
+		msg = "the nickname must not be empty"
+	case utf8.RuneCountInString(s) > maxNicknameLength:
+		msg = fmt.Sprintf("the nickname must not be longer than %d characters", maxNicknameLength)
+	case strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) != -1:
+		msg = "the nickname must only contain printable characters"
+	default:
+		return s, nil
+	}
+
+	return "", httpError{
+		msg:  msg,
+		code: http.StatusBadRequest,
+	}
+}
+
+// usedTokens holds the "started" tokens of the games added to a leaderboard,
+// so that each game is only added once. Like the tokens, see newTimeKey, it
+// does not survive a restart of the server.
+type usedTokens struct {
+	mu     sync.Mutex
+	tokens map[string]bool
+}
+
+func newUsedTokens() *usedTokens {
+	return &usedTokens{
+		tokens: make(map[string]bool),
+	}
+}
+
+// use marks token as used. It returns false if token was used already.
+func (u *usedTokens) use(token string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.tokens[token] {
+		return false
+	}
+	u.tokens[token] = true
+	return true
+}
+
+// release marks token as unused again.
+func (u *usedTokens) release(token string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	delete(u.tokens, token)
+}
+
+// The play URL has the time the game was started in the "started" parameter
+// and the time of the winning move in "finished". The server signs "started"
+// together with the level code, and "finished" together with the level code,
+// the "started" token and the moves that won the game. This keeps clients from
+// changing the times or combining tokens of different games. "started" is only
+// signed for a level without moves, "finished" only for a game with a valid
+// "started", and each "started" token is only added to the leaderboard once.
+// This does not keep a client from playing a known solution very quickly. A
+// time token is "<unix milliseconds>-<signature>".
+
+// newTimeKey returns a random key for signing times. Times signed with a
+// previous key cannot be verified.
+func newTimeKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// signTime returns a time token for t. The token is only valid together with
+// the same context, e.g. the level code.
+func (s server) signTime(t time.Time, context ...string) string {
+	ms := strconv.FormatInt(t.UnixMilli(), 10)
+	return ms + "-" + s.timeSignature(ms, context)
+}
+
+func (s server) timeSignature(ms string, context []string) string {
+	mac := hmac.New(sha256.New, s.timeKey)
+	mac.Write([]byte(strings.Join(append(context, ms), "@")))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// verifyTime returns the time in the token of request parameter name, which
+// must have been signed with context.
+func (s server) verifyTime(req *http.Request, name string, context ...string) (time.Time, error) {
+	ms, sig, ok := strings.Cut(req.FormValue(name), "-")
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if !ok || err != nil || !hmac.Equal([]byte(sig), []byte(s.timeSignature(ms, context))) {
+		return time.Time{}, httpError{
+			msg:  fmt.Sprintf("the %q time of the game cannot be verified; the game may have been started before the server restarted", name),
+			code: http.StatusBadRequest,
+		}
+	}
+	return time.UnixMilli(n), nil
+}
+
+func leaderboardURL(level watersort.State) (string, error) {
+	values, err := stateValues(level)
+	if err != nil {
+		return "", err
+	}
+	return "/leaderboard?" + values.Encode(), nil
+}
+
+// LeaderboardHandler shows the leaderboard of the level in the "code" or
+// "state" parameter. POST requests add a game: the "moves" parameter, as in the
+// play URL, must win the level; "started" and "finished" are the game's time
+// tokens and "nickname" the player's name.
+func (s server) LeaderboardHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	level, err := parseState(req)
+	if err != nil {
+		return err
+	}
+	if err := level.Validate(); err != nil {
+		return httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+
+	code, err := watersort.EncodeCode(level)
+	if err != nil {
+		return err
+	}
+	boardURL, err := leaderboardURL(level)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodPost {
+		nickname, err := parseNickname(req.FormValue("nickname"))
+		if err != nil {
+			return err
+		}
+
+		// Replaying checks that every move is possible.
+		g, err := replay(level, req)
+		if err != nil {
+			return err
+		}
+		if !g.Won() {
+			return httpError{
+				msg:  "the moves do not win the level",
+				code: http.StatusBadRequest,
+			}
+		}
+
+		started, err := s.verifyTime(req, "started", code)
+		if err != nil {
+			return err
+		}
+		finished, err := s.verifyTime(req, "finished", code, req.FormValue("started"), formatMoves(g.Steps()))
+		if err != nil {
+			return err
+		}
+		if finished.Before(started) {
+			return httpError{
+				msg:  "the game finished before it started",
+				code: http.StatusBadRequest,
+			}
+		}
+		if !s.submitted.use(req.FormValue("started")) {
+			return httpError{
+				msg:  "the game has already been added to the leaderboard",
+				code: http.StatusConflict,
+			}
+		}
+
+		err = s.leaderboards.Add(code, leaderboardEntry{
+			Nickname:   nickname,
+			Moves:      g.Moves(),
+			DurationMS: finished.Sub(started).Milliseconds(),
+			MoveList:   formatMoves(g.Steps()),
+			Submitted:  time.Now().UTC(),
+		})
+		if err != nil {
+			s.submitted.release(req.FormValue("started"))
+			return err
+		}
+
+		// Redirect, so that reloading the page does not submit the game again.
+		http.Redirect(w, req, boardURL, http.StatusSeeOther)
+		return nil
+	}
+
+	entries, err := s.leaderboards.Entries(code)
+	if err != nil {
+		return err
+	}
+	rankEntries(entries)
+
+	type row struct {
+		Rank      int
+		Entry     leaderboardEntry
+		ReplayURL string
+	}
+	var rows []row
+	for i, e := range entries {
+		steps, err := parseMoves(e.MoveList)
+		if err != nil {
+			return err
+		}
+		replayURL, err := playURL(level, steps)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row{
+			Rank:      i + 1,
+			Entry:     e,
+			ReplayURL: replayURL,
+		})
+	}
+
+	play, err := playURL(level, nil)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Code    string
+		Rows    []row
+		PlayURL string
+	}{
+		Code:    code,
+		Rows:    rows,
+		PlayURL: play,
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "leaderboard.html", data)
+}
+
+// LeaderboardsHandler lists the levels that have a leaderboard, with their
+// best game.
+func (s server) LeaderboardsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	codes, err := s.leaderboards.Levels()
+	if err != nil {
+		return err
+	}
+	sort.Strings(codes)
+
+	type board struct {
+		Code  string
+		URL   string
+		Games int
+		Best  leaderboardEntry
+	}
+	var boards []board
+	for _, code := range codes {
+		entries, err := s.leaderboards.Entries(code)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		rankEntries(entries)
+
+		boards = append(boards, board{
+			Code:  code,
+			URL:   "/leaderboard?code=" + code,
+			Games: len(entries),
+			Best:  entries[0],
+		})
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "leaderboards.html", boards)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+func testLevel(t *testing.T) (watersort.State, string, []watersort.Step) {
+	t.Helper()
+
+	level := watersort.State{
+		Bottles: []watersort.Bottle{
+			{Colors: []watersort.Color{watersort.Red, watersort.Blue}},
+			{Colors: []watersort.Color{watersort.Blue, watersort.Red}},
+			{Colors: []watersort.Color{watersort.Empty, watersort.Empty}},
+		},
+	}
+	code, err := watersort.EncodeCode(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := level.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return level, code, steps
+}
+
+func TestVerifyTime(t *testing.T) {
+	s := server{timeKey: []byte("test key")}
+	now := time.UnixMilli(1760000000000)
+	token := s.signTime(now, "code", "started")
+
+	cases := []struct {
+		name    string
+		token   string
+		context []string
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			token:   token,
+			context: []string{"code", "started"},
+		},
+		{
+			name:    "different context",
+			token:   token,
+			context: []string{"code", "other"},
+			wantErr: true,
+		},
+		{
+			name:    "missing context",
+			token:   token,
+			context: []string{"code"},
+			wantErr: true,
+		},
+		{
+			name:    "changed time",
+			token:   "1" + token,
+			context: []string{"code", "started"},
+			wantErr: true,
+		},
+		{
+			name:    "other key",
+			token:   server{timeKey: []byte("other key")}.signTime(now, "code", "started"),
+			context: []string{"code", "started"},
+			wantErr: true,
+		},
+		{
+			name:    "no signature",
+			token:   "1760000000000",
+			context: []string{"code", "started"},
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			context: []string{"code", "started"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+url.Values{"t": {tc.token}}.Encode(), nil)
+
+			got, err := s.verifyTime(req, "t", tc.context...)
+			if tc.wantErr {
+				var he httpError
+				if !errors.As(err, &he) || he.code != http.StatusBadRequest {
+					t.Errorf("verifyTime() = %v, want a %d error", err, http.StatusBadRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyTime() = %v", err)
+			}
+			if !got.Equal(now) {
+				t.Errorf("verifyTime() = %v, want %v", got, now)
+			}
+		})
+	}
+}
+
+func TestLeaderboardHandlerPost(t *testing.T) {
+	level, code, steps := testLevel(t)
+	moves := formatMoves(steps)
+	start := time.Now().Add(-time.Minute)
+
+	s := server{timeKey: []byte("test key")}
+	started := s.signTime(start, code)
+
+	cases := []struct {
+		name     string
+		values   url.Values
+		wantCode int
+		// wantDuration is the duration of the added entry.
+		wantDuration time.Duration
+	}{
+		{
+			name: "valid",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(5*time.Second), code, started, moves)},
+			},
+			wantCode:     http.StatusSeeOther,
+			wantDuration: 5 * time.Second,
+		},
+		{
+			name: "finished before started",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(-time.Hour), code, started, moves)},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "finished of another game",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(time.Second), code, s.signTime(start.Add(-time.Second), code), moves)},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "finished of other moves",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(time.Second), code, started, "")},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "finished signed as started",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(time.Second), code)},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "started of another level",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {moves},
+				"started":  {s.signTime(start, "other")},
+				"finished": {s.signTime(start.Add(time.Second), code, s.signTime(start, "other"), moves)},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "not won",
+			values: url.Values{
+				"nickname": {"alice"},
+				"moves":    {formatMoves(steps[:len(steps)-1])},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(time.Second), code, started, formatMoves(steps[:len(steps)-1]))},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "no nickname",
+			values: url.Values{
+				"moves":    {moves},
+				"started":  {started},
+				"finished": {s.signTime(start.Add(time.Second), code, started, moves)},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lb, err := newFileLeaderboard("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := s
+			s.leaderboards = lb
+			s.submitted = newUsedTokens()
+
+			values, err := stateValues(level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.values {
+				values[k] = v
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/leaderboard", strings.NewReader(values.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			err = s.LeaderboardHandler(context.Background(), w, req)
+			gotCode := w.Code
+			var he httpError
+			if errors.As(err, &he) {
+				gotCode = he.code
+			} else if err != nil {
+				t.Fatalf("LeaderboardHandler() = %v", err)
+			}
+			if gotCode != tc.wantCode {
+				t.Fatalf("LeaderboardHandler() status = %d (%v), want %d", gotCode, err, tc.wantCode)
+			}
+
+			entries, err := lb.Entries(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantCode != http.StatusSeeOther {
+				if len(entries) != 0 {
+					t.Errorf("got %d entries, want none", len(entries))
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if got := time.Duration(entries[0].DurationMS) * time.Millisecond; got != tc.wantDuration {
+				t.Errorf("DurationMS = %v, want %v", got, tc.wantDuration)
+			}
+			if got, want := entries[0].Moves, len(steps); got != want {
+				t.Errorf("Moves = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestLeaderboardHandlerPost_Resubmit(t *testing.T) {
+	level, code, steps := testLevel(t)
+	moves := formatMoves(steps)
+	start := time.Now().Add(-time.Minute)
+
+	lb, err := newFileLeaderboard("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server{
+		timeKey:      []byte("test key"),
+		leaderboards: lb,
+		submitted:    newUsedTokens(),
+	}
+
+	values, err := stateValues(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := s.signTime(start, code)
+	values.Set("nickname", "alice")
+	values.Set("moves", moves)
+	values.Set("started", started)
+	values.Set("finished", s.signTime(start.Add(5*time.Second), code, started, moves))
+
+	for i, wantCode := range []int{http.StatusSeeOther, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/leaderboard", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		err := s.LeaderboardHandler(context.Background(), w, req)
+		gotCode := w.Code
+		var he httpError
+		if errors.As(err, &he) {
+			gotCode = he.code
+		} else if err != nil {
+			t.Fatalf("LeaderboardHandler() = %v", err)
+		}
+		if gotCode != wantCode {
+			t.Errorf("submission %d: LeaderboardHandler() status = %d (%v), want %d", i+1, gotCode, err, wantCode)
+		}
+	}
+
+	entries, err := lb.Entries(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d entries, want 1", len(entries))
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// solveLimits protect the server from levels that take too long to solve and
+// from clients that solve too many levels. Zero values disable a limit.
+type solveLimits struct {
+	// Timeout is the time a request may spend solving levels.
+	Timeout time.Duration
+	// StreamTimeout replaces Timeout for requests that stream the solver's
+	// progress.
+	StreamTimeout time.Duration
+	// MaxStates is the number of states the solver may evaluate per solve.
+	MaxStates int
+	// MaxConcurrent is the number of requests solving levels at the same time.
+	MaxConcurrent int
+	// QueueTimeout is how long a request waits for one of the MaxConcurrent
+	// slots before it is rejected.
+	QueueTimeout time.Duration
+	// Rate is the number of requests per minute a client may solve levels in,
+	// with bursts of up to Burst requests.
+	Rate  int
+	Burst int
+}
+
+// solveLimiter enforces solveLimits.
+type solveLimiter struct {
+	limits solveLimits
+	// slots holds a token for each request currently solving.
+	slots chan struct{}
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is a token bucket rate limiting one client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newSolveLimiter(limits solveLimits) *solveLimiter {
+	l := &solveLimiter{
+		limits:  limits,
+		clients: make(map[string]*bucket),
+	}
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return l
+}
+
+// solveFunc solves s within the limits of the request it was created for.
+// Errors are httpErrors wrapping the solver's error.
+type solveFunc func(s watersort.State, opts ...watersort.Option) ([]watersort.Step, error)
+
+// solver admits the request to solve levels. It checks the client's rate limit
+// and waits for a free slot. release must be called when the request is done
+// solving.
+func (s server) solver(ctx context.Context, req *http.Request) (solve solveFunc, release func(), err error) {
+	return s.admit(ctx, req, s.limiter.limits.Timeout)
+}
+
+// admit is like solver, but with a custom timeout.
+func (s server) admit(ctx context.Context, req *http.Request, timeout time.Duration) (solve solveFunc, release func(), err error) {
+	l := s.limiter
+
+	if wait := l.allow(clientAddr(req), time.Now()); wait > 0 {
+		return nil, nil, httpError{
+			msg:        "too many requests, please try again later",
+			code:       http.StatusTooManyRequests,
+			retryAfter: wait,
+		}
+	}
+
+	freeSlot := func() {}
+	if l.slots != nil {
+		if err := l.acquire(ctx); err != nil {
+			return nil, nil, err
+		}
+		freeSlot = func() { <-l.slots }
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	solve = func(state watersort.State, opts ...watersort.Option) ([]watersort.Step, error) {
+		opts = append(opts, watersort.WithContext(ctx))
+		if l.limits.MaxStates > 0 {
+			opts = append(opts, watersort.MaxStates(l.limits.MaxStates))
+		}
+
+		steps, err := state.Solve(opts...)
+		switch {
+		case errors.Is(err, watersort.ErrNoSolution):
+			return nil, httpError{
+				msg:  "the level cannot be solved",
+				code: http.StatusUnprocessableEntity,
+				err:  err,
+			}
+		case errors.Is(err, watersort.ErrStateLimit):
+			return nil, httpError{
+				msg:  fmt.Sprintf("the level is too hard: the solver gave up after %d states", l.limits.MaxStates),
+				code: http.StatusUnprocessableEntity,
+				err:  err,
+			}
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, httpError{
+				msg:  fmt.Sprintf("the level is too hard: the solver gave up after %v", timeout),
+				code: http.StatusServiceUnavailable,
+				err:  err,
+			}
+		case errors.Is(err, context.Canceled):
+			return nil, httpError{
+				msg:  "the request was canceled",
+				code: http.StatusServiceUnavailable,
+				err:  err,
+			}
+		}
+		return steps, err
+	}
+
+	release = func() {
+		cancel()
+		freeSlot()
+	}
+	return solve, release, nil
+}
+
+// acquire waits for a free slot. If none becomes free within the queue
+// timeout or before ctx is done, the server is too busy.
+func (l *solveLimiter) acquire(ctx context.Context) error {
+	busy := httpError{
+		msg:        "the server is busy solving other levels, please try again later",
+		code:       http.StatusServiceUnavailable,
+		retryAfter: time.Second,
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.limits.QueueTimeout <= 0 {
+		return busy
+	}
+
+	t := time.NewTimer(l.limits.QueueTimeout)
+	defer t.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		return busy
+	case <-ctx.Done():
+		return httpError{
+			msg:  "the request was canceled while waiting for the solver",
+			code: http.StatusServiceUnavailable,
+			err:  ctx.Err(),
+		}
+	}
+}
+
+// allow takes a token from the client's bucket. If the bucket is empty, it
+// returns how long the client has to wait for the next token.
+func (l *solveLimiter) allow(client string, now time.Time) time.Duration {
+	if l.limits.Rate <= 0 {
+		return 0
+	}
+	perSecond := float64(l.limits.Rate) / 60
+	burst := float64(l.limits.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget clients whose buckets have filled up again, so that the map
+	// does not grow without bounds.
+	if now.Sub(l.lastSweep) > time.Minute {
+		for c, b := range l.clients {
+			if b.tokens+now.Sub(b.last).Seconds()*perSecond >= burst {
+				delete(l.clients, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.clients[client] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// clientAddr identifies the client of req by its IP address. Headers such as
+// X-Forwarded-For are ignored, because clients can set them freely.
+func clientAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// checkLevelSize rejects levels larger than the server handles.
+func checkLevelSize(s watersort.State) error {
+	if n := len(s.Bottles); n > maxBottles {
+		return httpError{
+			msg:  fmt.Sprintf("the level has %d bottles, the maximum is %d", n, maxBottles),
+			code: http.StatusRequestEntityTooLarge,
+		}
+	}
+	for i, b := range s.Bottles {
+		if n := len(b.Colors); n > maxBottleSize {
+			return httpError{
+				msg:  fmt.Sprintf("bottle %d has %d slots, the maximum is %d", i+1, n, maxBottleSize),
+				code: http.StatusRequestEntityTooLarge,
+			}
+		}
+	}
+	return nil
+}
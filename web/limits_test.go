@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+func TestSolveLimiterAllow(t *testing.T) {
+	start := time.Unix(1760000000, 0)
+
+	type request struct {
+		client string
+		after  time.Duration
+		// wantWait is the time the client has to wait, or zero if the
+		// request is allowed.
+		wantWait time.Duration
+	}
+	cases := []struct {
+		name     string
+		limits   solveLimits
+		requests []request
+	}{
+		{
+			name:   "no limit",
+			limits: solveLimits{},
+			requests: []request{
+				{client: "a"},
+				{client: "a"},
+				{client: "a"},
+			},
+		},
+		{
+			name:   "burst",
+			limits: solveLimits{Rate: 60, Burst: 2},
+			requests: []request{
+				{client: "a"},
+				{client: "a"},
+				{client: "a", wantWait: time.Second},
+				{client: "a", after: 500 * time.Millisecond, wantWait: 500 * time.Millisecond},
+				{client: "a", after: time.Second},
+				{client: "a", wantWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:   "burst defaults to one",
+			limits: solveLimits{Rate: 30},
+			requests: []request{
+				{client: "a"},
+				{client: "a", wantWait: 2 * time.Second},
+				{client: "a", after: 2 * time.Second},
+			},
+		},
+		{
+			name:   "clients are independent",
+			limits: solveLimits{Rate: 60, Burst: 1},
+			requests: []request{
+				{client: "a"},
+				{client: "a", wantWait: time.Second},
+				{client: "b"},
+				{client: "b", wantWait: time.Second},
+			},
+		},
+		{
+			name:   "refill up to burst",
+			limits: solveLimits{Rate: 60, Burst: 2},
+			requests: []request{
+				{client: "a"},
+				{client: "a", after: time.Hour},
+				{client: "a"},
+				{client: "a", wantWait: time.Second},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newSolveLimiter(tc.limits)
+
+			now := start
+			for i, r := range tc.requests {
+				now = now.Add(r.after)
+				if got := l.allow(r.client, now); got != r.wantWait {
+					t.Errorf("request %d: allow(%q) = %v, want %v", i+1, r.client, got, r.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestSolveLimiterAllow_ForgetsClients(t *testing.T) {
+	l := newSolveLimiter(solveLimits{Rate: 60, Burst: 1})
+	now := time.Unix(1760000000, 0)
+
+	l.allow("a", now)
+	l.allow("b", now.Add(2*time.Minute))
+	if _, ok := l.clients["a"]; ok {
+		t.Error("client \"a\" is still tracked after its bucket filled up")
+	}
+}
+
+func TestSolveLimiterAcquire(t *testing.T) {
+	cases := []struct {
+		name         string
+		queueTimeout time.Duration
+		// freeAfter frees the occupied slot after this time, if not zero.
+		freeAfter time.Duration
+		cancel    bool
+		wantErr   error
+		wantCode  int
+	}{
+		{
+			name:     "no queue",
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "queue timeout",
+			queueTimeout: 10 * time.Millisecond,
+			wantCode:     http.StatusServiceUnavailable,
+		},
+		{
+			name:         "slot freed while queued",
+			queueTimeout: time.Minute,
+			freeAfter:    10 * time.Millisecond,
+		},
+		{
+			name:         "canceled while queued",
+			queueTimeout: time.Minute,
+			cancel:       true,
+			wantErr:      context.Canceled,
+			wantCode:     http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newSolveLimiter(solveLimits{MaxConcurrent: 1, QueueTimeout: tc.queueTimeout})
+
+			if err := l.acquire(context.Background()); err != nil {
+				t.Fatalf("acquire() with a free slot = %v", err)
+			}
+			if tc.freeAfter > 0 {
+				time.AfterFunc(tc.freeAfter, func() { <-l.slots })
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+
+			err := l.acquire(ctx)
+			if tc.wantCode == 0 {
+				if err != nil {
+					t.Errorf("acquire() = %v, want nil", err)
+				}
+				return
+			}
+			var he httpError
+			if !errors.As(err, &he) || he.code != tc.wantCode {
+				t.Errorf("acquire() = %v, want a %d error", err, tc.wantCode)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("acquire() = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckLevelSize(t *testing.T) {
+	bottles := func(n, size int) []watersort.Bottle {
+		ret := make([]watersort.Bottle, n)
+		for i := range ret {
+			ret[i].Colors = make([]watersort.Color, size)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		name    string
+		in      watersort.State
+		wantErr bool
+	}{
+		{
+			name: "small",
+			in:   watersort.State{Bottles: bottles(3, 2)},
+		},
+		{
+			name: "largest",
+			in:   watersort.State{Bottles: bottles(maxBottles, maxBottleSize)},
+		},
+		{
+			name:    "too many bottles",
+			in:      watersort.State{Bottles: bottles(maxBottles+1, 2)},
+			wantErr: true,
+		},
+		{
+			name:    "bottle too large",
+			in:      watersort.State{Bottles: append(bottles(2, 2), watersort.Bottle{Colors: make([]watersort.Color, maxBottleSize+1)})},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkLevelSize(tc.in)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("checkLevelSize() = %v, want nil", err)
+				}
+				return
+			}
+
+			var he httpError
+			if !errors.As(err, &he) || he.code != http.StatusRequestEntityTooLarge {
+				t.Errorf("checkLevelSize() = %v, want a %d error", err, http.StatusRequestEntityTooLarge)
+			}
+		})
+	}
+}
@@ -3,15 +3,67 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"log"
+	"math"
 	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+var (
+	pack         = flag.String("pack", "", "level pack file that levels saved in the editor are added to")
+	daily        = flag.String("daily", "", "file that the daily puzzles and their stats are kept in; if empty, they are kept in memory")
+	leaderboards = flag.String("leaderboards", "", "file that the leaderboards are kept in; if empty, they are kept in memory")
+
+	solveTimeout      = flag.Duration("solve_timeout", 10*time.Second, "time a request may spend solving levels; 0 disables the limit")
+	streamTimeout     = flag.Duration("stream_solve_timeout", 2*time.Minute, "time a request streaming the solver's progress may spend solving; 0 disables the limit")
+	solveMaxStates    = flag.Int("solve_max_states", 500000, "number of states the solver may evaluate per level; 0 disables the limit")
+	maxSolves         = flag.Int("max_solves", runtime.NumCPU(), "number of requests solving levels at the same time; 0 disables the limit")
+	solveQueueTimeout = flag.Duration("solve_queue_timeout", 5*time.Second, "time a request waits for one of -max_solves before failing with 503")
+	solveRate         = flag.Int("solve_rate", 60, "number of requests per minute each client may solve levels in; 0 disables the limit")
+	solveBurst        = flag.Int("solve_burst", 10, "number of requests each client may solve levels in at once, see -solve_rate")
 )
 
 func main() {
-	srv := newServer()
+	flag.Parse()
+
+	boards, err := newFileLeaderboard(*leaderboards)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := newServer(*pack, *daily, boards, solveLimits{
+		Timeout:       *solveTimeout,
+		StreamTimeout: *streamTimeout,
+		MaxStates:     *solveMaxStates,
+		MaxConcurrent: *maxSolves,
+		QueueTimeout:  *solveQueueTimeout,
+		Rate:          *solveRate,
+		Burst:         *solveBurst,
+	})
 
 	http.Handle("/gen", contextHandler(srv.GenerateStateHandler))
 	http.Handle("/state", contextHandler(srv.StateHandler))
+	http.Handle("/solve", contextHandler(srv.SolveHandler))
+	http.Handle("/walkthrough", contextHandler(srv.WalkthroughHandler))
+	http.Handle("/play", contextHandler(srv.PlayHandler))
+	http.Handle("/daily", contextHandler(srv.DailyHandler))
+	http.Handle("/daily/", contextHandler(srv.DailyHandler))
+	http.Handle("/leaderboard", contextHandler(srv.LeaderboardHandler))
+	http.Handle("/leaderboards", contextHandler(srv.LeaderboardsHandler))
+	http.Handle("/editor", contextHandler(srv.EditorHandler))
+	http.Handle("/editor/save", apiHandler(srv.EditorSaveHandler))
+	http.Handle("/solution.gif", contextHandler(srv.SolutionGIFHandler))
+
+	http.Handle("/api/v1/solve", apiHandler(srv.APISolveHandler))
+	http.Handle("/api/v1/solve/stream", apiHandler(srv.SolveStreamHandler))
+	http.Handle("/api/v1/hint", apiHandler(srv.APIHintHandler))
+	http.Handle("/api/v1/validate", apiHandler(srv.APIValidateHandler))
+	http.Handle("/api/v1/generate", apiHandler(srv.APIGenerateHandler))
+	http.Handle("/api/v1/render", apiHandler(srv.APIRenderHandler))
+	http.Handle("/api/v1/openapi.json", apiHandler(srv.OpenAPIHandler))
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -28,6 +80,7 @@ func (hndl contextHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	var he httpError
 	if errors.As(err, &he) {
+		he.setHeaders(w.Header())
 		http.Error(w, err.Error(), he.StatusCode())
 		return
 	}
@@ -39,12 +92,28 @@ func (hndl contextHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 type httpError struct {
 	msg  string
 	code int
+	// retryAfter, if not zero, is sent in the Retry-After header.
+	retryAfter time.Duration
+	// err is the underlying error, if any.
+	err error
 }
 
 func (e httpError) Error() string {
 	return e.msg
 }
 
+func (e httpError) Unwrap() error {
+	return e.err
+}
+
 func (e httpError) StatusCode() int {
 	return e.code
 }
+
+// setHeaders sets the response headers belonging to the error.
+func (e httpError) setHeaders(h http.Header) {
+	if e.retryAfter > 0 {
+		seconds := int(math.Ceil(e.retryAfter.Seconds()))
+		h.Set("Retry-After", strconv.Itoa(seconds))
+	}
+}
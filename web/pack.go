@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/octo/watersort"
+)
+
+// packStore adds levels to a level pack file.
+type packStore struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// add appends l to the level pack. If l has no ID, one is assigned. The file
+// is created if it does not exist.
+func (ps *packStore) add(l watersort.Level) (watersort.Level, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pack, err := ps.load()
+	if err != nil {
+		return watersort.Level{}, err
+	}
+
+	if l.ID == "" {
+		for i := len(pack.Levels) + 1; ; i++ {
+			id := fmt.Sprintf("editor-%d", i)
+			if _, ok := pack.Level(id); !ok {
+				l.ID = id
+				break
+			}
+		}
+	}
+	if _, ok := pack.Level(l.ID); ok {
+		return watersort.Level{}, httpError{
+			msg:  fmt.Sprintf("the level pack already contains a level with ID %q", l.ID),
+			code: http.StatusConflict,
+		}
+	}
+	pack.Levels = append(pack.Levels, l)
+
+	if err := ps.write(pack); err != nil {
+		return watersort.Level{}, err
+	}
+	return l, nil
+}
+
+func (ps *packStore) load() (watersort.LevelPack, error) {
+	f, err := os.Open(ps.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return watersort.LevelPack{
+			Version: watersort.LevelPackVersion,
+			Name:    "Editor levels",
+		}, nil
+	}
+	if err != nil {
+		return watersort.LevelPack{}, err
+	}
+	defer f.Close()
+
+	pack, err := watersort.LoadLevelPack(f)
+	if err != nil {
+		return watersort.LevelPack{}, fmt.Errorf("%s: %w", ps.path, err)
+	}
+	return pack, nil
+}
+
+// write replaces the level pack file.
+func (ps *packStore) write(pack watersort.LevelPack) error {
+	return replaceFile(ps.path, func(w io.Writer) error {
+		return watersort.WriteLevelPack(w, pack)
+	})
+}
+
+// replaceFile replaces the file at path with the data written by write. The
+// data is written to a temporary file first, so that the file is never left
+// half-written.
+func replaceFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// The moves played so far are stored in the "moves" parameter of the play URL,
+// so that the game survives reloads and can be shared. Pours are written as
+// "<from>-<to>" with bottles numbered from 1, adding the extra bottle as "e".
+// Moves are separated by commas.
+const addBottleMove = "e"
+
+func formatMove(step watersort.Step) string {
+	if step.Type == watersort.AddBottle {
+		return addBottleMove
+	}
+	return fmt.Sprintf("%d-%d", step.From+1, step.To+1)
+}
+
+func parseMove(s string) (watersort.Step, error) {
+	if s == addBottleMove {
+		return watersort.Step{Type: watersort.AddBottle}, nil
+	}
+
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return watersort.Step{}, fmt.Errorf("invalid move %q", s)
+	}
+	f, err := strconv.Atoi(from)
+	if err != nil || f < 1 {
+		return watersort.Step{}, fmt.Errorf("invalid move %q", s)
+	}
+	t, err := strconv.Atoi(to)
+	if err != nil || t < 1 {
+		return watersort.Step{}, fmt.Errorf("invalid move %q", s)
+	}
+
+	return watersort.Step{From: f - 1, To: t - 1}, nil
+}
+
+func formatMoves(steps []watersort.Step) string {
+	moves := make([]string, len(steps))
+	for i, step := range steps {
+		moves[i] = formatMove(step)
+	}
+	return strings.Join(moves, ",")
+}
+
+// playURL returns the URL of the game of level s after steps were played.
+// params are additional key/value pairs.
+func playURL(s watersort.State, steps []watersort.Step, params ...string) (string, error) {
+	values, err := stateValues(s)
+	if err != nil {
+		return "", err
+	}
+
+	if len(steps) > 0 {
+		values.Set("moves", formatMoves(steps))
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		values.Set(params[i], params[i+1])
+	}
+
+	return "/play?" + values.Encode(), nil
+}
+
+// parseMoves parses moves in the format written by formatMoves.
+func parseMoves(s string) ([]watersort.Step, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var steps []watersort.Step
+	for i, m := range strings.Split(s, ",") {
+		step, err := parseMove(m)
+		if err != nil {
+			return nil, fmt.Errorf("move %d: %w", i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// replay starts a game of level s and plays the moves given in the "moves"
+// parameter.
+func replay(s watersort.State, req *http.Request) (*watersort.Game, error) {
+	g := watersort.NewGame(s)
+
+	steps, err := parseMoves(req.FormValue("moves"))
+	if err != nil {
+		return nil, httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+
+	for i, step := range steps {
+		if err := g.Move(step); err != nil {
+			return nil, httpError{
+				msg:  fmt.Sprintf("move %d: %v", i+1, err),
+				code: http.StatusBadRequest,
+			}
+		}
+	}
+
+	return g, nil
+}
+
+type playBottle struct {
+	Bottle watersort.Bottle
+	// URL is followed when the bottle is clicked.
+	URL      string
+	Selected bool
+	// Hint is "from" or "to" if the bottle is part of the hinted move.
+	Hint string
+}
+
+// PlayHandler lets the user play a level. Clicking a bottle selects it as
+// the source ("from" parameter); clicking another bottle then submits the move
+// ("move" parameter), which is checked and, if valid, appended to the moves
+// by redirecting to the new game URL.
+//
+// Games of the daily puzzle have the puzzle's date in the "daily" parameter.
+// Once won, the game can be submitted to the puzzle's stats and to the level's
+// leaderboard, see LeaderboardHandler for the "started" and "finished"
+// parameters.
+func (s server) PlayHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	level, err := parseState(req)
+	if err != nil {
+		return err
+	}
+	if err := level.Validate(); err != nil {
+		return httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+
+	daily := req.FormValue("daily")
+	if daily != "" {
+		if _, err := time.Parse(dailyDateLayout, daily); err != nil {
+			return httpError{
+				msg:  "invalid 'daily' parameter",
+				code: http.StatusBadRequest,
+			}
+		}
+	}
+
+	code, err := watersort.EncodeCode(level)
+	if err != nil {
+		return err
+	}
+	// The clock starts when the level is first shown. Games that have moves
+	// but no start time cannot be submitted to the leaderboard.
+	started := req.FormValue("started")
+	if started == "" && req.FormValue("moves") == "" && req.FormValue("move") == "" {
+		started = s.signTime(time.Now(), code)
+	}
+
+	// gameURL is like playURL, but keeps the "daily" and "started" parameters.
+	gameURL := func(steps []watersort.Step, params ...string) (string, error) {
+		if daily != "" {
+			params = append(params, "daily", daily)
+		}
+		if started != "" {
+			params = append(params, "started", started)
+		}
+		return playURL(level, steps, params...)
+	}
+
+	g, err := replay(level, req)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	if moveParam := req.FormValue("move"); moveParam != "" {
+		step, err := parseMove(moveParam)
+		if err == nil {
+			err = g.Move(step)
+		}
+		if err == nil {
+			// The clock only stops for games with a valid start time.
+			var params []string
+			if _, err := s.verifyTime(req, "started", code); err == nil && g.Won() {
+				params = []string{"finished", s.signTime(time.Now(), code, started, formatMoves(g.Steps()))}
+			}
+			url, err := gameURL(g.Steps(), params...)
+			if err != nil {
+				return err
+			}
+			http.Redirect(w, req, url, http.StatusSeeOther)
+			return nil
+		}
+		message = "That move is not possible: " + err.Error()
+	}
+
+	state := g.State()
+	steps := g.Steps()
+
+	// Hints and the win screen need the solver.
+	var solve solveFunc
+	if g.Won() || req.FormValue("hint") != "" {
+		var release func()
+		solve, release, err = s.solver(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	selected := -1
+	if fromParam := req.FormValue("from"); fromParam != "" {
+		from, err := strconv.Atoi(fromParam)
+		if err != nil || from < 1 || from > len(state.Bottles) {
+			return httpError{
+				msg:  "invalid 'from' parameter",
+				code: http.StatusBadRequest,
+			}
+		}
+		selected = from - 1
+	}
+
+	var hint *watersort.Step
+	if req.FormValue("hint") != "" && !g.Won() {
+		hintSteps, err := solve(state)
+		if errors.Is(err, watersort.ErrNoSolution) && g.ExtraBottlesLeft() > 0 {
+			hintSteps, err = solve(state, watersort.AllowExtraBottle())
+		}
+		switch {
+		case errors.Is(err, watersort.ErrNoSolution):
+			message = "There is no solution from here. Undo some moves or restart."
+		case err != nil:
+			return err
+		default:
+			hint = &hintSteps[0]
+			message = "Hint: " + describeStep(state.Palette, *hint)
+		}
+	}
+
+	var bottles []playBottle
+	for i, b := range state.Bottles {
+		pb := playBottle{
+			Bottle:   b,
+			Selected: i == selected,
+		}
+
+		switch {
+		case g.Won():
+		case selected == -1:
+			pb.URL, err = gameURL(steps, "from", strconv.Itoa(i+1))
+		case selected == i:
+			// Clicking the selected bottle again deselects it.
+			pb.URL, err = gameURL(steps)
+		default:
+			pb.URL, err = gameURL(steps, "move", formatMove(watersort.Step{From: selected, To: i}))
+		}
+		if err != nil {
+			return err
+		}
+
+		if hint != nil && hint.Type == watersort.Pour {
+			switch i {
+			case hint.From:
+				pb.Hint = "from"
+			case hint.To:
+				pb.Hint = "to"
+			}
+		}
+
+		bottles = append(bottles, pb)
+	}
+
+	data := struct {
+		State        watersort.State
+		Bottles      []playBottle
+		Moves        int
+		Message      string
+		Won          bool
+		Stuck        bool
+		Optimal      int
+		UndoURL      string
+		RestartURL   string
+		HintURL      string
+		AddBottleURL string
+		// DailyURL is the daily puzzle's page and LeaderboardURL the
+		// level's leaderboard. Won games are submitted to both with the
+		// following fields.
+		DailyURL       string
+		LeaderboardURL string
+		SubmitMoves    string
+		Started        string
+		Finished       string
+
+		MaxNicknameLength int
+	}{
+		State:   state,
+		Bottles: bottles,
+		Moves:   g.Moves(),
+		Message: message,
+		Won:     g.Won(),
+		Stuck:   !g.Won() && g.Stuck(),
+
+		MaxNicknameLength: maxNicknameLength,
+	}
+
+	if data.Won {
+		// The player may have used the extra bottle, so the shortest
+		// solution may use it, too.
+		optimal, err := solve(level, watersort.AllowExtraBottle())
+		if err != nil {
+			return err
+		}
+		data.Optimal = len(optimal)
+
+		if daily != "" {
+			data.DailyURL = "/daily/" + daily
+		}
+		if data.LeaderboardURL, err = leaderboardURL(level); err != nil {
+			return err
+		}
+		data.SubmitMoves = formatMoves(steps)
+		data.Started = started
+		data.Finished = req.FormValue("finished")
+	}
+
+	if len(steps) > 0 {
+		if data.UndoURL, err = gameURL(steps[:len(steps)-1]); err != nil {
+			return err
+		}
+		if data.RestartURL, err = gameURL(nil); err != nil {
+			return err
+		}
+	}
+	if !data.Won {
+		if data.HintURL, err = gameURL(steps, "hint", "1"); err != nil {
+			return err
+		}
+		if g.ExtraBottlesLeft() > 0 {
+			if data.AddBottleURL, err = gameURL(steps, "move", addBottleMove); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "play.html", data)
+}
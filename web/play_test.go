@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/octo/watersort"
+)
+
+func TestParseMove(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    watersort.Step
+		wantErr bool
+	}{
+		{in: "1-3", want: watersort.Step{From: 0, To: 2}},
+		{in: "12-10", want: watersort.Step{From: 11, To: 9}},
+		{in: "e", want: watersort.Step{Type: watersort.AddBottle}},
+		{in: "", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "1-", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "0-1", wantErr: true},
+		{in: "1-0", wantErr: true},
+		{in: "1--2", wantErr: true},
+		{in: "a-b", wantErr: true},
+		{in: "E", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parseMove(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseMove(%q) = %v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMove(%q) = %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseMove(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+			if got := formatMove(got); got != tc.in {
+				t.Errorf("formatMove() = %q, want %q", got, tc.in)
+			}
+		})
+	}
+}
+
+func TestParseMoves(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    []watersort.Step
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			in:   "",
+		},
+		{
+			name: "one move",
+			in:   "2-1",
+			want: []watersort.Step{{From: 1, To: 0}},
+		},
+		{
+			name: "extra bottle",
+			in:   "1-3,e,4-2",
+			want: []watersort.Step{
+				{From: 0, To: 2},
+				{Type: watersort.AddBottle},
+				{From: 3, To: 1},
+			},
+		},
+		{
+			name:    "trailing comma",
+			in:      "1-3,",
+			wantErr: true,
+		},
+		{
+			name:    "invalid move",
+			in:      "1-3,x,2-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseMoves(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseMoves(%q) = %v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMoves(%q) = %v", tc.in, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseMoves(%q) differs (-want/+got):\n%s", tc.in, diff)
+			}
+			if got := formatMoves(got); got != tc.in {
+				t.Errorf("formatMoves() = %q, want %q", got, tc.in)
+			}
+		})
+	}
+}
+
+func TestPlayHandler_Finished(t *testing.T) {
+	level, code, steps := testLevel(t)
+	s := server{timeKey: []byte("test key")}
+
+	cases := []struct {
+		name         string
+		started      string
+		wantFinished bool
+	}{
+		{
+			name:         "valid started",
+			started:      s.signTime(time.Now(), code),
+			wantFinished: true,
+		},
+		{
+			name: "no started",
+		},
+		{
+			name:    "started of another level",
+			started: s.signTime(time.Now(), "other"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := stateValues(level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values.Set("moves", formatMoves(steps[:len(steps)-1]))
+			values.Set("move", formatMove(steps[len(steps)-1]))
+			if tc.started != "" {
+				values.Set("started", tc.started)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/play?"+values.Encode(), nil)
+			w := httptest.NewRecorder()
+			if err := s.PlayHandler(context.Background(), w, req); err != nil {
+				t.Fatalf("PlayHandler() = %v", err)
+			}
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("PlayHandler() status = %d, want %d", w.Code, http.StatusSeeOther)
+			}
+
+			u, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := u.Query()
+			if got := query.Get("started"); got != tc.started {
+				t.Errorf("started = %q, want %q", got, tc.started)
+			}
+			if got := query.Get("finished") != ""; got != tc.wantFinished {
+				t.Errorf("got finished token = %v, want %v", got, tc.wantFinished)
+			}
+		})
+	}
+}
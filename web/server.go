@@ -1,107 +1,339 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/octo/watersort"
+	"github.com/octo/watersort/render"
 )
 
 type server struct {
 	tmpl *template.Template
+	// packs stores levels saved in the editor, or is nil if saving is disabled.
+	packs   *packStore
+	limiter *solveLimiter
+	daily   *dailyStore
+	// leaderboards stores the leaderboards; timeKey signs the times of
+	// games submitted to them, and submitted holds the games' "started"
+	// tokens.
+	leaderboards leaderboardStorage
+	timeKey      []byte
+	submitted    *usedTokens
 }
 
-func newServer() *server {
-	t, err := template.ParseGlob("templates/*.html")
+// newServer returns a new server. If packPath is not empty, levels saved in the
+// editor are added to the level pack at packPath. If dailyPath is not empty,
+// the daily puzzles and their stats are kept in that file. Games are added to
+// leaderboards.
+func newServer(packPath, dailyPath string, leaderboards leaderboardStorage, limits solveLimits) *server {
+	t, err := template.New("").Funcs(template.FuncMap{
+		"add":         func(a, b int) int { return a + b },
+		"bottleLabel": render.BottleLabel,
+	}).ParseGlob("templates/*.html")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	return &server{
-		tmpl: t,
+	daily, err := newDailyStore(dailyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &server{
+		tmpl:    t,
+		limiter: newSolveLimiter(limits),
+		daily:   daily,
+
+		leaderboards: leaderboards,
+		timeKey:      newTimeKey(),
+		submitted:    newUsedTokens(),
+	}
+	if packPath != "" {
+		srv.packs = &packStore{path: packPath}
 	}
+
+	return srv
 }
 
 func stateURL(s watersort.State) (string, error) {
-	stateParam, err := s.MarshalText()
+	values, err := stateValues(s)
 	if err != nil {
 		return "", err
 	}
+	return "/state?" + values.Encode(), nil
+}
+
+// stateValues returns the query parameters for s, as read by parseState.
+func stateValues(s watersort.State) (url.Values, error) {
+	code, err := watersort.EncodeCode(s)
+	if err != nil {
+		return nil, err
+	}
 
 	values := make(url.Values)
-	values.Set("state", string(stateParam))
+	values.Set("code", code)
 
-	return "/state?" + values.Encode(), nil
+	if s.Palette != nil {
+		paletteParam, err := json.Marshal(s.Palette)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("palette", string(paletteParam))
+	}
+
+	return values, nil
 }
 
+// GenerateStateHandler generates a random level and redirects to its page. The
+// redirect URL includes the seed and the generation parameters, so that the
+// level can be reproduced.
 func (s server) GenerateStateHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
-	state := watersort.RandomState(10, 4)
+	params, err := parseGenerateParams(req)
+	if err != nil {
+		return err
+	}
+
+	level, err := s.generate(ctx, req, params)
+	if err != nil {
+		return err
+	}
 
-	url, err := stateURL(state)
+	values, err := stateValues(level.State)
 	if err != nil {
 		return err
 	}
+	for k, v := range params.values(level.Seed) {
+		values[k] = v
+	}
 
-	http.Redirect(w, req, url, http.StatusFound)
+	http.Redirect(w, req, "/state?"+values.Encode(), http.StatusFound)
 	return nil
 }
 
-func (s server) StateHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
-	stateParam := req.FormValue("state")
-	if stateParam == "" {
-		return httpError{
-			msg:  "the required 'state' parameter is missing",
+// describeStep returns the description of step used by the solver command,
+// e.g. "pour 3 onto 12 (Red)". Bottles are numbered from 1.
+func describeStep(p watersort.Palette, step watersort.Step) string {
+	return strings.Join(strings.Fields(p.FormatStep(step)), " ")
+}
+
+// parseState reads the state from the request. The state is either given as a
+// level code in the "code" parameter, or in text form in the "state" parameter.
+// An optional "palette" parameter holds the palette as JSON.
+func parseState(req *http.Request) (watersort.State, error) {
+	var state watersort.State
+
+	if codeParam := req.FormValue("code"); codeParam != "" {
+		var err error
+		state, err = watersort.DecodeCode(codeParam)
+		if err != nil {
+			return watersort.State{}, httpError{
+				msg:  err.Error(),
+				code: http.StatusBadRequest,
+			}
+		}
+	} else if stateParam := req.FormValue("state"); stateParam != "" {
+		if err := state.UnmarshalText([]byte(stateParam)); err != nil {
+			return watersort.State{}, httpError{
+				msg:  "failed to parse the 'state' parameter",
+				code: http.StatusBadRequest,
+			}
+		}
+	} else {
+		return watersort.State{}, httpError{
+			msg:  "the required 'code' or 'state' parameter is missing",
 			code: http.StatusBadRequest,
 		}
 	}
 
-	var state watersort.State
-	if err := state.UnmarshalText([]byte(stateParam)); err != nil {
-		return httpError{
-			msg:  "failed to parse the 'state' parameter",
-			code: http.StatusBadRequest,
+	if err := checkLevelSize(state); err != nil {
+		return watersort.State{}, err
+	}
+
+	if paletteParam := req.FormValue("palette"); paletteParam != "" {
+		if err := json.Unmarshal([]byte(paletteParam), &state.Palette); err != nil {
+			return watersort.State{}, httpError{
+				msg:  "failed to parse the 'palette' parameter",
+				code: http.StatusBadRequest,
+			}
 		}
+	}
 
+	return state, nil
+}
+
+func (s server) StateHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	state, err := parseState(req)
+	if err != nil {
+		return err
 	}
 
 	solved := state.Solved()
 
 	var (
-		step      watersort.Step
-		nextState watersort.State
+		step        watersort.Step
+		description string
+		nextURL     string
 	)
 	if !solved {
-		steps, err := state.Solve()
+		solve, release, err := s.solver(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		steps, err := solve(state)
 		if err != nil {
 			return err
 		}
 		step = steps[0]
+		description = describeStep(state.Palette, step)
 
-		nextState = state.Clone()
+		nextState := state.Clone()
 		if err := nextState.Apply(step); err != nil {
 			return err
 		}
+
+		nextURL, err = stateURL(nextState)
+		if err != nil {
+			return err
+		}
 	}
 
-	nextURL, err := stateURL(nextState)
+	values, err := stateValues(state)
 	if err != nil {
 		return err
 	}
+	gifURL := "/solution.gif?" + values.Encode()
+	playURL := "/play?" + values.Encode()
+	editURL := "/editor?" + values.Encode()
+	walkthroughURL := "/walkthrough?" + values.Encode()
+
+	// Levels from /gen carry their seed; link to the URL that reproduces them.
+	var seed, genURL string
+	if seed = req.FormValue("seed"); seed != "" {
+		genValues := make(url.Values)
+		for _, k := range []string{"colors", "size", "empty", "seed", "min_difficulty", "max_difficulty"} {
+			if v := req.FormValue(k); v != "" {
+				genValues.Set(k, v)
+			}
+		}
+		genURL = "/gen?" + genValues.Encode()
+	}
 
 	data := struct {
-		State   watersort.State
-		Step    watersort.Step
-		NextURL string
-		Solved  bool
+		State          watersort.State
+		Step           watersort.Step
+		Description    string
+		NextURL        string
+		WalkthroughURL string
+		GIFURL         string
+		PlayURL        string
+		EditURL        string
+		Seed           string
+		GenURL         string
+		Solved         bool
 	}{
-		State:   state.Clone(),
-		Step:    step,
-		NextURL: nextURL,
-		Solved:  solved,
+		State:          state.Clone(),
+		Step:           step,
+		Description:    description,
+		NextURL:        nextURL,
+		WalkthroughURL: walkthroughURL,
+		GIFURL:         gifURL,
+		PlayURL:        playURL,
+		EditURL:        editURL,
+		Seed:           seed,
+		GenURL:         genURL,
+		Solved:         solved,
 	}
 
 	return s.tmpl.ExecuteTemplate(w, "state_show.html", data)
 }
+
+// parseTheme returns the render theme called name. The empty string selects
+// the default theme.
+func parseTheme(name string) (render.Theme, error) {
+	if name == "" {
+		return render.DefaultTheme, nil
+	}
+	theme, err := render.ParseTheme(name)
+	if err != nil {
+		return render.DefaultTheme, httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+	return theme, nil
+}
+
+// SolutionGIFHandler solves the state and responds with an animated GIF of the
+// solution. The optional "delay" parameter sets the time each step is shown,
+// e.g. "500ms". The "symbols", "legend" and "theme" parameters select the
+// accessible rendering options. Solutions longer than maxGIFSteps are not
+// animated.
+func (s server) SolutionGIFHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	state, err := parseState(req)
+	if err != nil {
+		return err
+	}
+
+	theme, err := parseTheme(req.FormValue("theme"))
+	if err != nil {
+		return err
+	}
+
+	opts := render.GIFOptions{
+		Highlight: true,
+		Captions:  true,
+		Symbols:   req.FormValue("symbols") != "",
+		Legend:    req.FormValue("legend") != "",
+		Theme:     theme,
+	}
+	if delayParam := req.FormValue("delay"); delayParam != "" {
+		d, err := time.ParseDuration(delayParam)
+		if err != nil || d <= 0 {
+			return httpError{
+				msg:  "failed to parse the 'delay' parameter",
+				code: http.StatusBadRequest,
+			}
+		}
+		opts.Delay = d
+	}
+
+	var steps []watersort.Step
+	if !state.Solved() {
+		solve, release, err := s.solver(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		steps, err = solve(state)
+		if err != nil {
+			return err
+		}
+	}
+	if len(steps) > maxGIFSteps {
+		return httpError{
+			msg:  fmt.Sprintf("the solution has %d steps, but animations are limited to %d steps", len(steps), maxGIFSteps),
+			code: http.StatusUnprocessableEntity,
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render.GIF(&buf, state, steps, opts); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/octo/watersort"
+)
+
+// progressEventInterval is the minimum time between two "progress" events.
+const progressEventInterval = 250 * time.Millisecond
+
+type progressEvent struct {
+	Expanded        int   `json:"expanded"`
+	StatesEvaluated int   `json:"states_evaluated"`
+	Frontier        int   `json:"frontier"`
+	Score           int   `json:"score"`
+	ElapsedMS       int64 `json:"elapsed_ms"`
+}
+
+// eventStream writes server-sent events. The response header is written with
+// the first event.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+func (es *eventStream) send(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if !es.started {
+		h := es.w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		// Keep reverse proxies from buffering the events.
+		h.Set("X-Accel-Buffering", "no")
+		es.w.WriteHeader(http.StatusOK)
+		es.started = true
+	}
+
+	if _, err := fmt.Fprintf(es.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	es.flusher.Flush()
+	return nil
+}
+
+// SolveStreamHandler solves the level given in the "code" or "state" parameter
+// and streams the solver's progress as server-sent events: "progress" events
+// while the solver is running, then a "solution" event with the solution file,
+// or an "error" event. The solver stops when the client disconnects.
+//
+// The optional "win_condition" and "extra_bottle" parameters are the same as
+// in solve requests.
+func (s server) SolveStreamHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("the response writer does not support flushing")
+	}
+
+	state, err := parseState(req)
+	if err != nil {
+		return err
+	}
+	if err := state.Validate(); err != nil {
+		return httpError{
+			msg:  err.Error(),
+			code: http.StatusUnprocessableEntity,
+		}
+	}
+
+	sr := solveRequest{
+		WinCondition: req.FormValue("win_condition"),
+		ExtraBottle:  req.FormValue("extra_bottle") != "",
+	}
+
+	solve, release, err := s.admit(ctx, req, s.limiter.limits.StreamTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	es := &eventStream{w: w, flusher: flusher}
+
+	start := time.Now()
+	var lastEvent time.Time
+	progress := watersort.ReportProgress(func(p watersort.Progress) {
+		if time.Since(lastEvent) < progressEventInterval {
+			return
+		}
+		lastEvent = time.Now()
+
+		// Errors are noticed by the solver when the client's context is done.
+		es.send("progress", progressEvent{
+			Expanded:        p.Expanded,
+			StatesEvaluated: p.StatesEvaluated,
+			Frontier:        p.Frontier,
+			Score:           p.Score,
+			ElapsedMS:       time.Since(start).Milliseconds(),
+		})
+	})
+
+	_, f, err := sr.solveState(state, func(state watersort.State, opts ...watersort.Option) ([]watersort.Step, error) {
+		return solve(state, append(opts, progress)...)
+	})
+	switch {
+	case err == nil:
+		return es.send("solution", f)
+	case ctx.Err() != nil:
+		// The client disconnected.
+		return nil
+	case !es.started:
+		return err
+	}
+
+	var he httpError
+	if !errors.As(err, &he) {
+		log.Printf("%s: %v", req.RequestURI, err)
+		he = httpError{
+			msg:  "Internal server error",
+			code: http.StatusInternalServerError,
+		}
+	}
+	return es.send("error", apiErrorDetailsJSON{
+		Status:  he.code,
+		Message: he.msg,
+	})
+}
+
+// SolveHandler shows the solver's progress while it solves the level, using
+// SolveStreamHandler, and then the solution.
+func (s server) SolveHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	state, err := parseState(req)
+	if err != nil {
+		return err
+	}
+
+	values, err := stateValues(state)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		StreamURL      string
+		WalkthroughURL string
+		PlayURL        string
+	}{
+		StreamURL:      "/api/v1/solve/stream?" + values.Encode(),
+		WalkthroughURL: "/walkthrough?" + values.Encode(),
+		PlayURL:        "/play?" + values.Encode(),
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "solve.html", data)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/octo/watersort"
+)
+
+// walkthroughFrame is the state before step Number+1 of the solution.
+type walkthroughFrame struct {
+	Number int
+	State  watersort.State
+	// Next is the step played from State, or nil in the solved state.
+	Next *watersort.SolutionStep
+	// Description describes Next.
+	Description string
+	// From and To are the bottles Next pours from and into, or -1.
+	From, To int
+}
+
+// WalkthroughHandler solves the level once and shows every state of the
+// solution. Navigating between the steps happens in the browser.
+func (s server) WalkthroughHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	level, err := parseState(req)
+	if err != nil {
+		return err
+	}
+	if err := level.Validate(); err != nil {
+		return httpError{
+			msg:  err.Error(),
+			code: http.StatusBadRequest,
+		}
+	}
+
+	var steps []watersort.Step
+	if !level.Solved() {
+		solve, release, err := s.solver(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		steps, err = solve(level)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The solution file has the color and amount of each step.
+	f, err := watersort.NewSolutionFile(level, steps, watersort.SolverStats{})
+	if err != nil {
+		return err
+	}
+
+	var frames []walkthroughFrame
+	state := level.Clone()
+	for i := range f.Steps {
+		step := f.Steps[i]
+		frame := walkthroughFrame{
+			Number:      i,
+			State:       state.Clone(),
+			Next:        &step,
+			Description: describeStep(state.Palette, step.Step),
+			From:        -1,
+			To:          -1,
+		}
+		if step.Type == watersort.Pour {
+			frame.From, frame.To = step.From, step.To
+		}
+		frames = append(frames, frame)
+
+		if err := state.Apply(step.Step); err != nil {
+			return err
+		}
+	}
+	frames = append(frames, walkthroughFrame{
+		Number: len(f.Steps),
+		State:  state,
+		From:   -1,
+		To:     -1,
+	})
+
+	values, err := stateValues(level)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Frames  []walkthroughFrame
+		Steps   int
+		PlayURL string
+	}{
+		Frames:  frames,
+		Steps:   len(f.Steps),
+		PlayURL: "/play?" + values.Encode(),
+	}
+
+	return s.tmpl.ExecuteTemplate(w, "walkthrough.html", data)
+}
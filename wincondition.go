@@ -0,0 +1,102 @@
+package watersort
+
+import "fmt"
+
+// WinCondition decides when a level is won.
+type WinCondition interface {
+	// Won returns true if s satisfies the win condition.
+	Won(s State) bool
+	// MinRequiredMoves returns a lower bound of the number of moves required
+	// to get from s to a winning state. The solver uses this as its heuristic,
+	// so it must never overestimate.
+	MinRequiredMoves(s State) int
+
+	fmt.Stringer
+}
+
+var (
+	// Sorted requires every bottle to hold a single color and every color to
+	// be gathered in a single bottle. This is the default win condition.
+	Sorted WinCondition = sorted{}
+	// SingleColorBottles requires every bottle to hold a single color, but
+	// a color may be spread across multiple bottles.
+	SingleColorBottles WinCondition = singleColorBottles{}
+	// FullBottles requires every bottle to be either empty or full with a
+	// single color.
+	FullBottles WinCondition = fullBottles{}
+)
+
+// DefaultWinCondition is used when no other win condition is specified.
+var DefaultWinCondition = Sorted
+
+var winConditionByName = map[string]WinCondition{
+	Sorted.String():             Sorted,
+	SingleColorBottles.String(): SingleColorBottles,
+	FullBottles.String():        FullBottles,
+}
+
+// WinConditionByName returns the win condition whose String() method returns name.
+func WinConditionByName(name string) (WinCondition, error) {
+	if wc, ok := winConditionByName[name]; ok {
+		return wc, nil
+	}
+	return nil, fmt.Errorf("unknown win condition %q", name)
+}
+
+type sorted struct{}
+
+func (sorted) Won(s State) bool {
+	return s.minRequiredMoves() == 0
+}
+
+func (sorted) MinRequiredMoves(s State) int {
+	return s.minRequiredMoves()
+}
+
+func (sorted) String() string {
+	return "sorted"
+}
+
+type singleColorBottles struct{}
+
+func (singleColorBottles) Won(s State) bool {
+	return singleColorBottles{}.MinRequiredMoves(s) == 0
+}
+
+// MinRequiredMoves returns the sum of Bottle.MinRequiredMoves(). A single pour
+// moves one color group and can therefore reduce this sum by at most one.
+func (singleColorBottles) MinRequiredMoves(s State) int {
+	ret := 0
+	for _, b := range s.Bottles {
+		ret += b.MinRequiredMoves()
+	}
+	return ret
+}
+
+func (singleColorBottles) String() string {
+	return "single_color_bottles"
+}
+
+type fullBottles struct{}
+
+func (fullBottles) Won(s State) bool {
+	for _, b := range s.Bottles {
+		if b.TopColor() != Empty && !b.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+func (fullBottles) MinRequiredMoves(s State) int {
+	ret := singleColorBottles{}.MinRequiredMoves(s)
+	if ret == 0 && !(fullBottles{}).Won(s) {
+		// At least one partially filled bottle needs to be topped up.
+		ret = 1
+	}
+	return ret
+}
+
+func (fullBottles) String() string {
+	return "full_bottles"
+}